@@ -0,0 +1,359 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Command is a single command to execute in each directory
+type Command struct {
+	Line string   // Command line as written by the user
+	Args []string // Tokenized arguments, empty when the command runs through a shell
+
+	Timeout time.Duration // Overrides Config.StepTimeout when set
+	Retry   *RetryPolicy  // Overrides Config.Retry when set
+
+	ContinueOnError  bool  // A failure is recorded but does not stop the directory
+	AlwaysRun        bool  // Runs even after an earlier step failed, e.g. cleanup steps
+	AllowedExitCodes []int // Non-zero exit codes that count as success
+}
+
+// String returns the command line as written by the user
+func (c Command) String() string {
+	return c.Line
+}
+
+// AllowsExitCode reports whether the command succeeds with the given exit code
+func (c Command) AllowsExitCode(code int) bool {
+	return code == 0 || slices.Contains(c.AllowedExitCodes, code)
+}
+
+// KeepStepSettings copies the per-step settings of previous commands onto the commands
+// with the same command line, so editing a command list does not lose them
+func KeepStepSettings(commands, previous []Command) []Command {
+	for i, command := range commands {
+		for _, old := range previous {
+			if old.Line == command.Line {
+				old.Args = command.Args
+				commands[i] = old
+				break
+			}
+		}
+	}
+	return commands
+}
+
+// ErrShellSyntax is returned when a command uses shell features (pipes, redirects,
+// command lists, substitutions) that only work when running through a shell
+var ErrShellSyntax = errors.New("shell syntax requires shell mode (-shell)")
+
+// ParseCommands splits a list of commands separated by semicolons or newlines.
+// Separators inside quotes are preserved. Unless shell mode is enabled every command
+// is tokenized with SplitArgs, expanding variables through LookupEnv.
+func (c *Config) ParseCommands(input string) ([]Command, error) {
+	lines, err := splitCommandList(input)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommandLines(lines, c.Shell, c.LookupEnv)
+}
+
+// LookupEnv resolves a variable from the configured Env, then from the process environment
+func (c *Config) LookupEnv(name string) string {
+	for i := len(c.Env) - 1; i >= 0; i-- {
+		if key, value, ok := strings.Cut(c.Env[i], "="); ok && key == name {
+			return value
+		}
+	}
+	return os.Getenv(name)
+}
+
+func parseCommandLines(lines []string, shell bool, lookup func(string) string) ([]Command, error) {
+	var commands []Command
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		commands = append(commands, Command{Line: line})
+	}
+	return tokenizeCommands(commands, shell, lookup)
+}
+
+// tokenizeCommands fills in the arguments of each command for the given mode,
+// dropping commands that have no arguments
+func tokenizeCommands(commands []Command, shell bool, lookup func(string) string) ([]Command, error) {
+	var tokenized []Command
+	for _, command := range commands {
+		command.Args = nil
+		if !shell {
+			args, err := SplitArgs(command.Line, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("invalid command %q: %w", command.Line, err)
+			}
+			if len(args) == 0 {
+				continue
+			}
+			command.Args = args
+		}
+		tokenized = append(tokenized, command)
+	}
+	return tokenized, nil
+}
+
+// DefaultShellInterpreter returns the interpreter used in shell mode when none is configured
+func DefaultShellInterpreter() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C"}
+	}
+	return []string{"sh", "-c"}
+}
+
+// ParseInterpreter tokenizes a shell interpreter setting such as "bash -lc",
+// falling back to DefaultShellInterpreter when the setting is empty
+func ParseInterpreter(input string) ([]string, error) {
+	args, err := SplitArgs(input, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shell interpreter %q: %w", input, err)
+	}
+	if len(args) == 0 {
+		return DefaultShellInterpreter(), nil
+	}
+	return args, nil
+}
+
+// splitCommandList splits input on unquoted semicolons and newlines
+func splitCommandList(input string) ([]string, error) {
+	var parts []string
+	var current strings.Builder
+	var quote rune
+	escaped := false
+
+	for _, r := range input {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			}
+		case r == '\\':
+			escaped = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';' || r == '\n':
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, strings.TrimSpace(current.String()))
+	}
+	return append(parts, current.String()), nil
+}
+
+// SplitArgs tokenizes a command line following POSIX shell quoting rules:
+// whitespace separates arguments, single quotes preserve everything literally,
+// double quotes allow $VAR expansion and backslash escapes of $ ` " \ and newline,
+// and an unquoted backslash escapes the next character.
+// Variables are expanded through lookup without further word splitting; a nil lookup
+// leaves them untouched. Unquoted shell operators return ErrShellSyntax.
+// Comments and tilde expansion are not handled: # and ~ are ordinary characters.
+func SplitArgs(line string, lookup func(string) string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(line)
+
+	flush := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+
+		case r == '\\':
+			inWord = true
+			if i+1 >= len(runes) {
+				word.WriteRune(r)
+				break
+			}
+			i++
+			if runes[i] != '\n' { // Backslash-newline is a line continuation
+				word.WriteRune(runes[i])
+			}
+
+		case r == '\'':
+			inWord = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ' quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+
+		case r == '"':
+			inWord = true
+			end, err := readDoubleQuoted(runes, i+1, &word, lookup)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+
+		case r == '$':
+			inWord = true
+			next, err := expandVariable(runes, i, &word, lookup)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+
+		case strings.ContainsRune("|&;<>()`", r):
+			return nil, fmt.Errorf("%w: unexpected %q", ErrShellSyntax, r)
+
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	flush()
+
+	return args, nil
+}
+
+// readDoubleQuoted consumes a double quoted string starting after the opening quote
+// and returns the index of the closing quote
+func readDoubleQuoted(runes []rune, start int, word *strings.Builder, lookup func(string) string) (int, error) {
+	for i := start; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '"':
+			return i, nil
+		case '\\':
+			if i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+				i++
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+				}
+			} else {
+				word.WriteRune(r)
+			}
+		case '$':
+			next, err := expandVariable(runes, i, word, lookup)
+			if err != nil {
+				return 0, err
+			}
+			i = next
+		case '`':
+			return 0, fmt.Errorf("%w: command substitution", ErrShellSyntax)
+		default:
+			word.WriteRune(r)
+		}
+	}
+	return 0, fmt.Errorf("unterminated \" quote")
+}
+
+// expandVariable expands $NAME or ${NAME} at runes[start] and returns the index of
+// the last consumed rune. A $ not followed by a variable name is kept literally.
+func expandVariable(runes []rune, start int, word *strings.Builder, lookup func(string) string) (int, error) {
+	i := start + 1
+	if i >= len(runes) {
+		word.WriteRune('$')
+		return start, nil
+	}
+
+	var name string
+	end := start
+	switch {
+	case runes[i] == '(':
+		return 0, fmt.Errorf("%w: command substitution", ErrShellSyntax)
+	case runes[i] == '{':
+		closing := indexRune(runes, i+1, '}')
+		if closing < 0 {
+			return 0, fmt.Errorf("unterminated ${ in variable expansion")
+		}
+		name = string(runes[i+1 : closing])
+		if !isVariableName(name) {
+			return 0, fmt.Errorf("bad variable name %q", name)
+		}
+		end = closing
+	default:
+		j := i
+		for j < len(runes) && (runes[j] == '_' || isAlpha(runes[j]) || (j > i && isDigit(runes[j]))) {
+			j++
+		}
+		if j == i {
+			word.WriteRune('$')
+			return start, nil
+		}
+		name = string(runes[i:j])
+		end = j - 1
+	}
+
+	if lookup == nil {
+		word.WriteString(string(runes[start : end+1]))
+	} else {
+		word.WriteString(lookup(name))
+	}
+	return end, nil
+}
+
+// JoinArgs is the inverse of SplitArgs, quoting arguments that contain special characters
+func JoinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n\\'\"$|&;<>()`*?[]#~") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+func indexRune(runes []rune, start int, target rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
+func isVariableName(name string) bool {
+	if name == "" || isDigit(rune(name[0])) {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !isAlpha(r) && !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	env := map[string]string{"NAME": "World", "EMPTY": "", "SPACED": "a b"}
+	lookup := func(name string) string { return env[name] }
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`npm  test`, []string{"npm", "test"}},
+		{"go\ttest ./...", []string{"go", "test", "./..."}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo 'it''s'`, []string{"echo", "its"}},
+		{`echo "it's"`, []string{"echo", "it's"}},
+		{`echo '$NAME "x"'`, []string{"echo", `$NAME "x"`}},
+		{`echo a\ b \"c\"`, []string{"echo", "a b", `"c"`}},
+		{`echo "\$NAME \\ \" \n"`, []string{"echo", `$NAME \ " \n`}},
+		{"echo a\\\nb", []string{"echo", "ab"}},
+		{`echo ""`, []string{"echo", ""}},
+		{`echo $NAME ${NAME}s "$NAME!"`, []string{"echo", "World", "Worlds", "World!"}},
+		{`echo $SPACED`, []string{"echo", "a b"}},
+		{`echo $EMPTY $UNSET`, []string{"echo", "", ""}},
+		{`echo $ 5$ $1`, []string{"echo", "$", "5$", "$1"}},
+		{`echo a#b # not a comment`, []string{"echo", "a#b", "#", "not", "a", "comment"}},
+		{`ls ~ ~/src`, []string{"ls", "~", "~/src"}},
+		{`echo "a | b" 'c > d'`, []string{"echo", "a | b", "c > d"}},
+		{`echo \| \;`, []string{"echo", "|", ";"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.line, lookup)
+		if err != nil {
+			t.Errorf("SplitArgs(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsWithoutLookup(t *testing.T) {
+	got, err := SplitArgs(`echo $HOME "${USER}"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"echo", "$HOME", "${USER}"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	tests := []struct {
+		line  string
+		shell bool // Fails with ErrShellSyntax
+		want  string
+	}{
+		{line: `ls | grep go`, shell: true},
+		{line: `make && make test`, shell: true},
+		{line: `make; make test`, shell: true},
+		{line: `echo hi > out.txt`, shell: true},
+		{line: `cat < in.txt`, shell: true},
+		{line: `(cd src)`, shell: true},
+		{line: "echo `date`", shell: true},
+		{line: `echo "$(date)"`, shell: true},
+		{line: `echo "a` + "`date`" + `"`, shell: true},
+		{line: `echo 'a`, want: "unterminated ' quote"},
+		{line: `echo "a`, want: `unterminated " quote`},
+		{line: `echo ${NAME`, want: "unterminated ${"},
+		{line: `echo ${1X}`, want: "bad variable name"},
+	}
+	for _, tt := range tests {
+		_, err := SplitArgs(tt.line, func(string) string { return "" })
+		switch {
+		case err == nil:
+			t.Errorf("SplitArgs(%q) succeeded", tt.line)
+		case tt.shell && !errors.Is(err, ErrShellSyntax):
+			t.Errorf("SplitArgs(%q) = %v, want ErrShellSyntax", tt.line, err)
+		case !tt.shell && !strings.Contains(err.Error(), tt.want):
+			t.Errorf("SplitArgs(%q) = %v, want %q", tt.line, err, tt.want)
+		}
+	}
+}
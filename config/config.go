@@ -6,25 +6,375 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/directories"
+	"github.com/gustavodamazio/mdir-run/logger"
+	"github.com/gustavodamazio/mdir-run/progress"
 )
 
 type Config struct {
 	InitialDir         string
-	Commands           [][]string
+	Commands           []Command
 	Concurrency        int
 	LogFile            string
 	SubDirsEntryPoints []string
-	Retries            int
+	LogDir             string              // Directory holding a log directory per run, the default of DefaultLogDir when empty
+	RunID              string              // Identifier of the run, naming its log directory
+	Retry              RetryPolicy         // Retry behavior for commands without their own policy
+	Shell              bool                // Run each command through ShellInterpreter
+	ShellInterpreter   []string            // Interpreter and arguments preceding the command line, e.g. sh -c
+	Env                []string            // Extra KEY=VALUE variables for every command
+	DirsFrom           string              // File listing the directories to process, "-" for stdin; replaces discovery
+	RerunFailed        string              // Result manifest or log archive whose unfinished directories are processed again
+	RerunDirs          []string            // Directories loaded from RerunFailed; replaces discovery
+	StartSteps         map[string]int      // Step (1-indexed) each directory starts at, the first when missing
+	Resume             bool                // Continue the interrupted run recorded in the journal next to LogFile
+	RestartPartial     bool                // With Resume, run partially completed directories from the first step
+	IncludeDirs        []string            // Only process directories matching one of these patterns
+	ExcludeDirs        []string            // Skip directories matching one of these patterns
+	Depth              int                 // Levels below InitialDir searched for directories, 1 for direct children
+	IgnoreFiles        []string            // Names of .gitignore-style files that exclude directories
+	SkipHidden         bool                // Leave out directories whose name starts with a dot
+	Parents            bool                // Also process directories that contain other selected directories
+	Symlinks           string              // Policy for symlinked directories, see directories.SymlinkSkip
+	Require            directories.Markers // Only process directories containing these marker files
+	Projects           []Project           // Project types with their own commands, matched in order
+	GracePeriod        time.Duration       // Time between SIGTERM and SIGKILL when a command is cancelled
+	StepTimeout        time.Duration       // Limit for a single command attempt, 0 for none
+	DirTimeout         time.Duration       // Limit for all commands of a directory, 0 for none
+	FailFast           bool                // Stop starting directories after the first failure
+	MaxFailures        int                 // Stop starting directories after this many failures, 0 for no limit
+	MaxFailureRate     float64             // Stop starting directories once this fraction of all directories failed, 0 for no limit
+	AbortRunning       bool                // Cancel running directories as well once a failure limit is reached
+	Stream             bool                // Show command output live, prefixed with its directory, instead of the progress view
+	Output             string              // Format of the CLI output, see OutputText
+	JUnit              string              // Path of the JUnit XML report written after the run, empty for none
+	HTMLReport         bool                // Write an HTML report next to LogFile, included in the log archive
+	MarkdownSummary    string              // Path of the markdown summary written after the run, empty for none
+	ArchiveFormat      string              // Format of the log archive, see logger.ArchiveZip; logger.DefaultArchiveFormat when empty
+	KeepRawLogs        bool                // Keep the log files next to their archive instead of deleting them
+	KeepRuns           int                 // Number of most recent runs whose logs are kept in the log directory, 0 for all
+	MaxLogAge          time.Duration       // Delete the logs of runs older than this from the log directory, 0 to keep them
+
+	Journal *progress.JournalState // State of the interrupted run loaded for Resume
+}
+
+// Directories returns the directories to process, relative to InitialDir unless they were
+// listed with an absolute path in DirsFrom
+func (c *Config) Directories() ([]string, error) {
+	switch {
+	case c.Journal != nil:
+		return c.Journal.Dirs, nil
+	case c.RerunFailed != "":
+		return directories.SelectFromList(c.InitialDir, c.RerunDirs, c.DiscoveryOptions())
+	case c.DirsFrom != "":
+		dirs, err := directories.ReadList(c.DirsFrom)
+		if err != nil {
+			return nil, err
+		}
+		return directories.SelectFromList(c.InitialDir, dirs, c.DiscoveryOptions())
+	}
+	return directories.Discover(c.InitialDir, c.DiscoveryOptions())
+}
+
+// loadRerun selects the unfinished directories of the run described by a result manifest
+// or log archive, optionally starting each at the step that failed
+func (c *Config) loadRerun(path string, fromFailedStep bool) error {
+	manifest, err := progress.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	c.RerunFailed = path
+	c.RerunDirs = manifest.Unfinished()
+	if *DirFlag == "" {
+		c.InitialDir = manifest.Dir
+	}
+	if fromFailedStep {
+		c.StartSteps = manifest.FailedSteps()
+	}
+	return nil
+}
+
+// loadResume loads the journal of the run runID, or of the last interrupted run of InitialDir
+// when runID is empty. The directory and commands of the interrupted run are used when not
+// given, and checked against it when given; shellSet tells whether -shell was given.
+func (c *Config) loadResume(runID string, shellSet bool) error {
+	if runID == "" {
+		found, err := c.findInterruptedRun()
+		if err != nil {
+			return err
+		}
+		runID = found
+	}
+	if err := c.useRun(runID); err != nil {
+		return err
+	}
+	state, err := progress.LoadJournal(c.LogFile)
+	if err != nil {
+		return err
+	}
+	if state.Finished {
+		return fmt.Errorf("cannot resume: run %s already finished", runID)
+	}
+	if c.InitialDir == "" {
+		c.InitialDir = state.Dir
+	}
+	if len(c.Commands) == 0 && len(c.Projects) == 0 {
+		if state.Projects {
+			return fmt.Errorf("cannot resume: the interrupted run used project commands, pass its run file with -f")
+		}
+		if !shellSet {
+			c.Shell = state.Shell
+		} else if c.Shell != state.Shell {
+			return fmt.Errorf("cannot resume: the interrupted run used -shell=%t", state.Shell)
+		}
+		commands, err := parseCommandLines(state.Commands, c.Shell, c.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+		c.Commands = commands
+	}
+	if err := state.Check(c.InitialDir, c.CommandLines(), c.Shell); err != nil {
+		return fmt.Errorf("cannot resume: %w", err)
+	}
+	c.Journal = state
+	c.StartSteps = state.StartSteps(c.RestartPartial)
+	return nil
+}
+
+// JournalRun describes the run over dirs for its journal
+func (c *Config) JournalRun(dirs []string) progress.JournalRun {
+	return progress.JournalRun{
+		Dir:      c.InitialDir,
+		Dirs:     dirs,
+		Commands: c.CommandLines(),
+		Shell:    c.Shell,
+		Projects: len(c.Projects) > 0,
+	}
+}
+
+// DirPath returns the path of a directory returned by Directories
+func (c *Config) DirPath(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(c.InitialDir, dir)
+}
+
+// WorkDir returns where the commands of a directory returned by Directories run: its first
+// existing subdirectory entry point, or the directory itself
+func (c *Config) WorkDir(dir string) string {
+	dirPath := c.DirPath(dir)
+	for _, subDir := range c.SubDirsEntryPoints {
+		subDirPath := filepath.Join(dirPath, subDir)
+		if stat, err := os.Stat(subDirPath); err == nil && stat.IsDir() {
+			return subDirPath
+		}
+	}
+	return dirPath
+}
+
+// DiscoveryOptions returns the settings used to find the directories to process
+func (c *Config) DiscoveryOptions() directories.Options {
+	opts := directories.Options{
+		Depth:       c.Depth,
+		Include:     c.IncludeDirs,
+		Exclude:     c.ExcludeDirs,
+		IgnoreFiles: c.IgnoreFiles,
+		SkipHidden:  c.SkipHidden,
+		Parents:     c.Parents,
+		Symlinks:    c.Symlinks,
+	}
+	opts.Markers = c.Require
+
+	// Without fallback commands, directories matching no project have nothing to run
+	if len(c.Commands) == 0 {
+		for _, project := range c.Projects {
+			opts.AnyOf = append(opts.AnyOf, project.Markers)
+		}
+	}
+	return opts
+}
+
+// FailureLimitReached reports whether failures out of total directories stop the run
+func (c *Config) FailureLimitReached(failures, total int) bool {
+	switch {
+	case failures == 0:
+		return false
+	case c.FailFast:
+		return true
+	case c.MaxFailures > 0 && failures >= c.MaxFailures:
+		return true
+	case c.MaxFailureRate > 0 && total > 0 && float64(failures)/float64(total) >= c.MaxFailureRate:
+		return true
+	}
+	return false
+}
+
+const (
+	// DefaultConcurrency is the number of directories processed at once when not configured
+	DefaultConcurrency = 10
+	// DefaultGracePeriod is how long a cancelled command may take to exit before it is killed
+	DefaultGracePeriod = 5 * time.Second
+)
+
+// Output formats of the CLI
+const (
+	OutputText = "text" // Progress view, or the live output with -stream
+	OutputJSON = "json" // Newline-delimited JSON events on standard output, see progress.EventsVersion
+)
+
+// Ways -resume handles directories that were interrupted between steps
+const (
+	ResumeNextStep = "next"    // Continue at the step after the last finished one
+	ResumeRestart  = "restart" // Run every step again
+)
+
+// Duration is a time.Duration written as a string such as "90s" or "5m" in run files
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (use values like 30s, 5m or 1h30m)", text)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Rate is a fraction written as a percentage such as "20%" or a number such as 0.2 in run files
+type Rate float64
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	value, err := ParseRate(string(text))
+	if err != nil {
+		return err
+	}
+	*r = Rate(value)
+	return nil
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(r)*100, 'f', -1, 64) + "%"), nil
+}
+
+// UnmarshalTOML accepts both TOML numbers and strings
+func (r *Rate) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case float64:
+		return r.UnmarshalText([]byte(strconv.FormatFloat(v, 'f', -1, 64)))
+	case int64:
+		return r.UnmarshalText([]byte(strconv.FormatInt(v, 10)))
+	case string:
+		return r.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("invalid rate %v (use values like 20%% or 0.2)", value)
+}
+
+// ParseRate parses a fraction between 0 and 1 written as "20%" or "0.2"
+func ParseRate(input string) (float64, error) {
+	number, scale := strings.TrimSpace(input), 1.0
+	if trimmed, ok := strings.CutSuffix(number, "%"); ok {
+		number, scale = strings.TrimSpace(trimmed), 100
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value/scale < 0 || value/scale > 1 {
+		return 0, fmt.Errorf("invalid rate %q (use values like 20%% or 0.2)", input)
+	}
+	return value / scale, nil
+}
+
+// Age is a time.Duration that may also be written in days, such as "30d", in run files
+type Age time.Duration
+
+func (a *Age) UnmarshalText(text []byte) error {
+	value, err := ParseAge(string(text))
+	if err != nil {
+		return err
+	}
+	*a = Age(value)
+	return nil
+}
+
+func (a Age) MarshalText() ([]byte, error) {
+	if day := 24 * time.Hour; a > 0 && time.Duration(a)%day == 0 {
+		return []byte(strconv.FormatInt(int64(time.Duration(a)/day), 10) + "d"), nil
+	}
+	return []byte(time.Duration(a).String()), nil
+}
+
+// ParseAge parses a duration such as "30d", "12h" or "90m"; empty means 0
+func ParseAge(input string) (time.Duration, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(input, "d"); ok {
+		if value, err := strconv.Atoi(days); err == nil && value >= 0 {
+			return time.Duration(value) * 24 * time.Hour, nil
+		}
+	} else if value, err := time.ParseDuration(input); err == nil && value >= 0 {
+		return value, nil
+	}
+	return 0, fmt.Errorf("invalid age %q (use values like 30d or 12h)", input)
 }
 
 // Command line flags
 var (
-	CommandsFlag    = flag.String("commands", "", "Commands to execute, separated by semicolons")
-	DirFlag         = flag.String("dir", "", "Directory in which to execute")
-	ConcurrencyFlag = flag.Int("concurrency", 10, "Number of concurrent operations")
-	SubDirsFlag     = flag.String("subdirs", "", "Subdirectories entry points to run commands in, separated by semicolons")
-	RetriesFlag     = flag.Int("retries", 0, "Number of retries for failed commands")
+	CommandsFlag     = flag.String("commands", "", "Commands to execute, separated by semicolons")
+	DirFlag          = flag.String("dir", "", "Directory in which to execute")
+	ConcurrencyFlag  = flag.Int("concurrency", DefaultConcurrency, "Number of concurrent operations")
+	SubDirsFlag      = flag.String("subdirs", "", "Subdirectories entry points to run commands in, separated by semicolons")
+	RetriesFlag      = flag.Int("retries", 0, "Number of retries for failed commands")
+	ShellFlag        = flag.Bool("shell", false, "Run each command through a shell interpreter (enables pipes, redirects, && and variable expansion)")
+	InterpreterFlag  = flag.String("shell-interpreter", "", "Interpreter used with -shell (default \"sh -c\", \"cmd /C\" on Windows)")
+	GraceFlag        = flag.Duration("grace-period", DefaultGracePeriod, "Time a cancelled command gets to exit after SIGTERM before it is killed")
+	StepTimeoutFlag  = flag.Duration("step-timeout", 0, "Maximum duration of a single command attempt, e.g. 10m (0 for no limit)")
+	DirTimeoutFlag   = flag.Duration("dir-timeout", 0, "Maximum duration of all commands in a directory, e.g. 30m (0 for no limit)")
+	RetryTimeoutFlag = flag.Bool("retry-timeouts", false, "Retry commands that exceeded -step-timeout")
+	BackoffFlag      = flag.String("retry-backoff", BackoffLinear, "Growth of the delay between retries: constant, linear or exponential")
+	RetryDelayFlag   = flag.Duration("retry-delay", DefaultRetryDelay, "Base delay between retries")
+	MaxDelayFlag     = flag.Duration("retry-max-delay", 0, "Upper bound for the delay between retries (0 for none)")
+	JitterFlag       = flag.Float64("retry-jitter", 0, "Fraction of the retry delay (0-1) randomly added or removed")
+	RetryCodesFlag   = flag.String("retry-on-exit-codes", "", "Only retry failures with these exit codes, separated by commas")
+	RetryStderrFlag  = flag.String("retry-on-stderr", "", "Only retry failures whose stderr matches this regular expression")
+	FailFastFlag     = flag.Bool("fail-fast", false, "Stop starting new directories after the first failure")
+	MaxFailuresFlag  = flag.Int("max-failures", 0, "Stop starting new directories after this many failures (0 for no limit)")
+	FailureRateFlag  = flag.String("max-failure-rate", "", "Stop starting new directories once this share of all directories failed, e.g. 20%")
+	AbortFlag        = flag.Bool("abort-running", false, "Also cancel running directories when a failure limit is reached (default: let them finish)")
+	DirsFromFlag     = flag.String("dirs-from", "", "File listing the directories to process, one per line (- for stdin); relative paths are resolved against -dir")
+	RerunFlag        = flag.String("rerun-failed", "", "Process only the directories that did not succeed in a previous run, from its results.json or log archive")
+	FailedStepFlag   = flag.Bool("from-failed-step", false, "With -rerun-failed, start each directory at the step that failed")
+	LogDirFlag       = flag.String("log-dir", "", "Directory receiving a log directory per run (default $XDG_STATE_HOME/mdir-run/runs or ~/.local/state/mdir-run/runs)")
+	RunIDFlag        = flag.String("run-id", "", "Identifier of the run, naming its log directory (default: generated); with -resume, the run to continue")
+	ResumeFlag       = flag.Bool("resume", false, "Continue the last interrupted run, of -dir when given, skipping the directories it finished; its directory and commands are used unless given")
+	PartialFlag      = flag.String("resume-partial", ResumeNextStep, "With -resume, partially completed directories restart at the next step or from scratch: next or restart")
+	DepthFlag        = flag.Int("depth", 1, "Levels below -dir searched for directories (1 for direct children only)")
+	IncludeFlag      = flag.String("include", "", "Only process directories matching these glob patterns (** allowed), separated by semicolons")
+	ExcludeFlag      = flag.String("exclude", "", "Skip directories matching these glob patterns (** allowed), separated by semicolons")
+	IgnoreFilesFlag  = flag.String("ignore-files", directories.DefaultIgnoreFile, "Names of .gitignore-style files excluding directories, separated by semicolons")
+	SkipHiddenFlag   = flag.Bool("skip-hidden", false, "Leave out directories whose name starts with a dot")
+	ParentsFlag      = flag.Bool("parents", false, "With -depth, also process directories that contain other selected directories")
+	SymlinksFlag     = flag.String("symlinks", directories.SymlinkSkip, "Symlinked directories: skip, include (without descending) or follow")
+	RequireFlag      = flag.String("require", "", "Only process directories containing files matching these glob patterns, separated by semicolons")
+	MatchFlag        = listFlag("match", "Only process directories with a file whose content matches, as FILE:REGEX (repeatable)")
+	OutputFlag       = flag.String("output", OutputText, "Format of the output: text, or json for newline-delimited JSON events")
+	JUnitFlag        = flag.String("junit", "", "Write a JUnit XML report to this file: one testsuite per directory, one testcase per command")
+	HTMLReportFlag   = flag.Bool("html-report", false, "Write a self-contained HTML report of the run, included in the log archive")
+	MarkdownFlag     = flag.String("markdown-summary", "", "Write a markdown summary of the run to this file, for pull requests and chat")
+	ArchiveFlag      = flag.String("archive-format", "", "Format of the log archive: zip, tar.gz, tar.zst or none to leave the log files in place (default zip on Windows, tar.gz elsewhere)")
+	KeepRawFlag      = flag.Bool("keep-raw-logs", false, "Keep the log files next to their archive instead of deleting them")
+	KeepRunsFlag     = flag.Int("keep-runs", 0, "Only keep the logs of this many most recent runs in the log directory (0 to keep all)")
+	MaxLogAgeFlag    = flag.String("max-log-age", "", "Delete the logs of runs older than this from the log directory, e.g. 30d (default: keep them)")
+	StreamFlag       = flag.Bool("stream", false, "Show the output of every command live, prefixed with its directory, instead of the progress view")
+	RunFileFlag      = flag.String("f", "", "Run file (YAML or TOML) describing the job; other flags override its settings")
 )
 
 func ParseConfig() (*Config, error) {
@@ -32,41 +382,319 @@ func ParseConfig() (*Config, error) {
 
 	reader := bufio.NewReader(os.Stdin)
 
-	// Abstracted input parsing
-	initialDir := getInput("Enter the directory in which to execute: ", DirFlag, reader)
-	commandsInput := getInput("Enter the commands to execute, separated by semicolons: ", CommandsFlag, reader)
+	cfg := &Config{Retry: DefaultRetryPolicy()}
+	fromRunFile := *RunFileFlag != ""
+	if fromRunFile {
+		loaded, err := LoadRunFile(*RunFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	// Flags set on the command line take precedence over the run file
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	override := func(name string) bool {
+		return !fromRunFile || explicit[name]
+	}
+
+	if override("concurrency") {
+		cfg.Concurrency = *ConcurrencyFlag
+	}
+	if override("shell") {
+		cfg.Shell = *ShellFlag
+	}
+	if override("grace-period") {
+		cfg.GracePeriod = *GraceFlag
+	}
+	if override("step-timeout") {
+		cfg.StepTimeout = *StepTimeoutFlag
+	}
+	if override("dir-timeout") {
+		cfg.DirTimeout = *DirTimeoutFlag
+	}
+
+	// Process directory discovery
+	if override("dirs-from") {
+		cfg.DirsFrom = *DirsFromFlag
+	}
+	if override("depth") {
+		if *DepthFlag < 1 {
+			return nil, fmt.Errorf("depth must be at least 1")
+		}
+		cfg.Depth = *DepthFlag
+	}
+	if override("include") {
+		cfg.IncludeDirs = splitList(*IncludeFlag)
+	}
+	if override("exclude") {
+		cfg.ExcludeDirs = splitList(*ExcludeFlag)
+	}
+	if override("ignore-files") {
+		cfg.IgnoreFiles = splitList(*IgnoreFilesFlag)
+	}
+	if override("skip-hidden") {
+		cfg.SkipHidden = *SkipHiddenFlag
+	}
+	if override("parents") {
+		cfg.Parents = *ParentsFlag
+	}
+	if override("symlinks") {
+		if err := directories.ValidateSymlinks(*SymlinksFlag); err != nil {
+			return nil, err
+		}
+		cfg.Symlinks = *SymlinksFlag
+	}
+
+	// Process marker files
+	if override("require") {
+		cfg.Require.Require = splitList(*RequireFlag)
+		if err := cfg.Require.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if override("match") {
+		cfg.Require.Match = nil
+		for _, input := range *MatchFlag {
+			match, err := directories.ParseContentMatch(input)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Require.Match = append(cfg.Require.Match, match)
+		}
+	}
+
+	// Process failure limits
+	if override("fail-fast") {
+		cfg.FailFast = *FailFastFlag
+	}
+	if override("max-failures") {
+		if *MaxFailuresFlag < 0 {
+			return nil, fmt.Errorf("max failures must not be negative")
+		}
+		cfg.MaxFailures = *MaxFailuresFlag
+	}
+	if override("max-failure-rate") {
+		cfg.MaxFailureRate = 0
+		if *FailureRateFlag != "" {
+			rate, err := ParseRate(*FailureRateFlag)
+			if err != nil {
+				return nil, err
+			}
+			cfg.MaxFailureRate = rate
+		}
+	}
+	if override("abort-running") {
+		cfg.AbortRunning = *AbortFlag
+	}
+
+	// Process retry policy
+	if err := applyRetryFlags(&cfg.Retry, override); err != nil {
+		return nil, err
+	}
+
+	// Process shell interpreter
+	if override("shell-interpreter") {
+		interpreter, err := ParseInterpreter(*InterpreterFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ShellInterpreter = interpreter
+	}
 
 	// Process subdirectories
-	subDirs := []string{}
-	if *SubDirsFlag != "" {
-		for _, subDir := range strings.Split(*SubDirsFlag, ";") {
-			subDirs = append(subDirs, strings.TrimSpace(subDir))
+	if override("subdirs") {
+		cfg.SubDirsEntryPoints = []string{}
+		if *SubDirsFlag != "" {
+			for _, subDir := range strings.Split(*SubDirsFlag, ";") {
+				cfg.SubDirsEntryPoints = append(cfg.SubDirsEntryPoints, strings.TrimSpace(subDir))
+			}
+		}
+	}
+
+	// Process the directories of a previous run
+	if *RerunFlag != "" {
+		if err := cfg.loadRerun(*RerunFlag, *FailedStepFlag); err != nil {
+			return nil, err
+		}
+	} else if *FailedStepFlag {
+		return nil, fmt.Errorf("-from-failed-step requires -rerun-failed")
+	}
+	cfg.Stream = *StreamFlag
+	cfg.JUnit = *JUnitFlag
+	cfg.HTMLReport = *HTMLReportFlag
+	cfg.MarkdownSummary = *MarkdownFlag
+	switch *OutputFlag {
+	case OutputText, OutputJSON:
+		cfg.Output = *OutputFlag
+	default:
+		return nil, fmt.Errorf("invalid -output %q: use %s or %s", *OutputFlag, OutputText, OutputJSON)
+	}
+	if cfg.Stream && cfg.Output == OutputJSON {
+		return nil, fmt.Errorf("-stream cannot be combined with -output %s", OutputJSON)
+	}
+	cfg.Resume = *ResumeFlag
+	switch *PartialFlag {
+	case ResumeNextStep:
+	case ResumeRestart:
+		cfg.RestartPartial = true
+	default:
+		return nil, fmt.Errorf("invalid -resume-partial %q: use %s or %s", *PartialFlag, ResumeNextStep, ResumeRestart)
+	}
+	if cfg.Resume && cfg.RerunFailed != "" {
+		return nil, fmt.Errorf("-resume cannot be combined with -rerun-failed")
+	}
+
+	// Abstracted input parsing; a directory list makes -dir optional, and -resume takes the
+	// directory and commands of the interrupted run when they are not given
+	if *DirFlag == "" && cfg.InitialDir == "" && cfg.DirsFrom != "" && !cfg.Resume {
+		workDir, err := os.Getwd()
+		if err != nil {
+			return nil, err
 		}
+		cfg.InitialDir = workDir
+	}
+	if *DirFlag != "" || (cfg.InitialDir == "" && !cfg.Resume) {
+		cfg.InitialDir = getInput("Enter the directory in which to execute: ", DirFlag, reader)
+	}
+	if cfg.InitialDir != "" {
+		// Journals record the directory, and -resume compares it, as a clean absolute path
+		dir, err := filepath.Abs(cfg.InitialDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory %s: %w", cfg.InitialDir, err)
+		}
+		cfg.InitialDir = dir
 	}
 
-	// Process commands
-	commandsStrings := strings.Split(commandsInput, ";")
-	var commands [][]string
-	for _, cmd := range commandsStrings {
-		cmd = strings.TrimSpace(cmd)
-		if cmd == "" {
-			continue
+	// Process commands, tokenized again so that -shell can override the run file
+	if *CommandsFlag != "" || (len(cfg.Commands) == 0 && len(cfg.Projects) == 0 && !cfg.Resume) {
+		if *CommandsFlag == "" && cfg.DirsFrom == "-" {
+			return nil, fmt.Errorf("-commands or -f is required when reading directories from stdin")
+		}
+		commandsInput := getInput("Enter the commands to execute, separated by semicolons: ", CommandsFlag, reader)
+		commands, err := cfg.ParseCommands(commandsInput)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Commands = commands
+	} else {
+		commands, err := tokenizeCommands(cfg.Commands, cfg.Shell, cfg.LookupEnv)
+		if err != nil {
+			return nil, err
 		}
-		cmdArgs := strings.Fields(cmd)
-		commands = append(commands, cmdArgs)
+		cfg.Commands = commands
+	}
+	if err := cfg.TokenizeProjects(); err != nil {
+		return nil, err
 	}
 
-	// Create log file path
-	logFile := filepath.Join(initialDir, "script.log")
+	// Every run logs to a directory of its own
+	if override("log-dir") {
+		cfg.LogDir = *LogDirFlag
+	}
+	if override("archive-format") {
+		if err := logger.ValidateArchiveFormat(*ArchiveFlag); err != nil {
+			return nil, err
+		}
+		cfg.ArchiveFormat = *ArchiveFlag
+	}
+	if override("keep-raw-logs") {
+		cfg.KeepRawLogs = *KeepRawFlag
+	}
+	if override("keep-runs") {
+		if *KeepRunsFlag < 0 {
+			return nil, fmt.Errorf("keep runs must not be negative")
+		}
+		cfg.KeepRuns = *KeepRunsFlag
+	}
+	if override("max-log-age") {
+		age, err := ParseAge(*MaxLogAgeFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxLogAge = age
+	}
+	if cfg.Resume {
+		if err := cfg.loadResume(*RunIDFlag, explicit["shell"]); err != nil {
+			return nil, err
+		}
+	} else if *RunIDFlag != "" {
+		if err := cfg.useRun(*RunIDFlag); err != nil {
+			return nil, err
+		}
+	} else if err := cfg.StartRun(); err != nil {
+		return nil, err
+	}
 
-	return &Config{
-		InitialDir:         initialDir,
-		Commands:           commands,
-		Concurrency:        *ConcurrencyFlag,
-		LogFile:            logFile,
-		SubDirsEntryPoints: subDirs,
-		Retries:            *RetriesFlag,
-	}, nil
+	return cfg, nil
+}
+
+// applyRetryFlags copies the retry flags selected by override into policy
+func applyRetryFlags(policy *RetryPolicy, override func(string) bool) error {
+	if override("retries") {
+		policy.Retries = *RetriesFlag
+	}
+	if override("retry-timeouts") {
+		policy.OnTimeout = *RetryTimeoutFlag
+	}
+	if override("retry-backoff") {
+		if err := validateBackoff(*BackoffFlag); err != nil {
+			return err
+		}
+		policy.Backoff = *BackoffFlag
+	}
+	if override("retry-delay") {
+		policy.Delay = *RetryDelayFlag
+	}
+	if override("retry-max-delay") {
+		policy.MaxDelay = *MaxDelayFlag
+	}
+	if override("retry-jitter") {
+		if *JitterFlag < 0 || *JitterFlag > 1 {
+			return fmt.Errorf("retry jitter must be between 0 and 1")
+		}
+		policy.Jitter = *JitterFlag
+	}
+	if override("retry-on-exit-codes") {
+		codes, err := ParseExitCodes(*RetryCodesFlag)
+		if err != nil {
+			return err
+		}
+		policy.OnExitCodes = codes
+	}
+	if override("retry-on-stderr") {
+		policy.OnStderr = nil
+		if *RetryStderrFlag != "" {
+			patterns, err := compilePatterns([]string{*RetryStderrFlag})
+			if err != nil {
+				return err
+			}
+			policy.OnStderr = patterns
+		}
+	}
+	return nil
+}
+
+// listFlag defines a flag that may be repeated, collecting every value
+func listFlag(name, usage string) *[]string {
+	var values []string
+	flag.Func(name, usage, func(value string) error {
+		values = append(values, value)
+		return nil
+	})
+	return &values
+}
+
+// splitList splits a semicolon separated flag value, dropping empty entries
+func splitList(input string) []string {
+	var items []string
+	for _, item := range strings.Split(input, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func getInput(prompt string, flagValue *string, reader *bufio.Reader) string {
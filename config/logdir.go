@@ -0,0 +1,118 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/logger"
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// LogFileName is the name of the main log file in the directory of a run
+const LogFileName = "script.log"
+
+// DefaultLogDir returns where the logs of runs are kept unless configured:
+// $XDG_STATE_HOME/mdir-run/runs, ~/.local/state/mdir-run/runs without it,
+// or %LOCALAPPDATA%\mdir-run\runs on Windows
+func DefaultLogDir() (string, error) {
+	if dir := os.Getenv("LOCALAPPDATA"); runtime.GOOS == "windows" && dir != "" {
+		return filepath.Join(dir, "mdir-run", "runs"), nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "mdir-run", "runs"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the default log directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "mdir-run", "runs"), nil
+}
+
+// NewRunID returns a unique run identifier that sorts by start time, e.g. 20250101-120000-3f9a1c
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// validateRunID checks that a run ID can be used as a directory name
+func validateRunID(runID string) error {
+	if runID == "" || runID == "." || runID == ".." || filepath.Base(runID) != runID || filepath.IsAbs(runID) {
+		return fmt.Errorf("invalid run ID %q: it must be a plain directory name", runID)
+	}
+	return nil
+}
+
+// logBase returns LogDir, or the default log directory when it is not set
+func (c *Config) logBase() (string, error) {
+	if c.LogDir != "" {
+		return c.LogDir, nil
+	}
+	return DefaultLogDir()
+}
+
+// StartRun gives the configuration a new run ID and points LogFile into the directory of that run
+func (c *Config) StartRun() error {
+	return c.useRun(NewRunID())
+}
+
+// useRun points LogFile into the directory of runID under the log directory
+func (c *Config) useRun(runID string) error {
+	if err := validateRunID(runID); err != nil {
+		return err
+	}
+	base, err := c.logBase()
+	if err != nil {
+		return err
+	}
+	c.RunID = runID
+	c.LogFile = filepath.Join(base, runID, LogFileName)
+	return nil
+}
+
+// findInterruptedRun returns the most recent run in the log directory with the journal of an
+// unfinished run of InitialDir, or of any directory when InitialDir is empty
+func (c *Config) findInterruptedRun() (string, error) {
+	base, err := c.logBase()
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	// Run IDs sort by start time, and entries by name
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].IsDir() {
+			continue
+		}
+		state, err := progress.LoadJournal(filepath.Join(base, entries[i].Name(), LogFileName))
+		if err == nil && !state.Finished && (c.InitialDir == "" || state.Dir == c.InitialDir) {
+			return entries[i].Name(), nil
+		}
+	}
+	if c.InitialDir == "" {
+		return "", fmt.Errorf("no interrupted run to resume in %s", base)
+	}
+	return "", fmt.Errorf("no interrupted run of %s to resume in %s", c.InitialDir, base)
+}
+
+// PruneRuns deletes the logs of the runs beyond KeepRuns and MaxLogAge from the log
+// directory, never those of the current run. Returns the deleted directories
+func (c *Config) PruneRuns() ([]string, error) {
+	if c.KeepRuns == 0 && c.MaxLogAge == 0 {
+		return nil, nil
+	}
+	base, err := c.logBase()
+	if err != nil {
+		return nil, err
+	}
+	return logger.PruneRuns(base, c.KeepRuns, c.MaxLogAge, c.RunID)
+}
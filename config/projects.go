@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/gustavodamazio/mdir-run/directories"
+)
+
+// Project is a kind of directory recognized by its marker files, with its own commands
+type Project struct {
+	Name     string
+	Markers  directories.Markers
+	Commands []Command
+}
+
+// CommandsFor returns the commands to run in dir: those of the first project whose
+// markers dir satisfies, otherwise Commands. The project name is empty when no project matched.
+func (c *Config) CommandsFor(dir string) ([]Command, string, error) {
+	for _, project := range c.Projects {
+		matched, err := project.Markers.Matches(dir)
+		if err != nil {
+			return nil, "", err
+		}
+		if matched {
+			return project.Commands, project.Name, nil
+		}
+	}
+	return c.Commands, "", nil
+}
+
+// TokenizeProjects tokenizes the commands of every project again, after Shell changed
+func (c *Config) TokenizeProjects() error {
+	for i := range c.Projects {
+		commands, err := tokenizeCommands(c.Projects[i].Commands, c.Shell, c.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("project %s: %w", c.Projects[i].Name, err)
+		}
+		c.Projects[i].Commands = commands
+	}
+	return nil
+}
+
+// CommandLines lists the command lines of the run, followed by those of every project
+// prefixed with its name
+func (c *Config) CommandLines() []string {
+	var lines []string
+	for _, command := range c.Commands {
+		lines = append(lines, command.Line)
+	}
+	for _, project := range c.Projects {
+		for _, command := range project.Commands {
+			lines = append(lines, project.Name+": "+command.Line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// interruptRun journals run in a new run directory of logDir without finishing it
+func interruptRun(t *testing.T, logDir string, run progress.JournalRun) string {
+	t.Helper()
+	runID := NewRunID()
+	logFile := filepath.Join(logDir, runID, LogFileName)
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := progress.CreateJournal(logFile, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	return runID
+}
+
+func TestLoadResume(t *testing.T) {
+	run := progress.JournalRun{
+		Dir:      "/srv/services",
+		Dirs:     []string{"api", "web"},
+		Commands: []string{"npm ci", "npm test | tee test.log"},
+		Shell:    true,
+	}
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		shellSet bool
+		wantErr  string
+	}{
+		{name: "nothing given"},
+		{name: "same directory", cfg: Config{InitialDir: "/srv/services"}},
+		{name: "same shell mode", cfg: Config{Shell: true}, shellSet: true},
+		{name: "other directory", cfg: Config{InitialDir: "/srv/other"}, wantErr: "no interrupted run of /srv/other"},
+		{name: "other shell mode", shellSet: true, wantErr: "used -shell=true"},
+		{
+			name:    "other commands",
+			cfg:     Config{Commands: []Command{{Line: "npm ci"}}, Shell: true},
+			wantErr: "commands differ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logDir := t.TempDir()
+			runID := interruptRun(t, logDir, run)
+			cfg := tt.cfg
+			cfg.LogDir = logDir
+
+			err := cfg.loadResume("", tt.shellSet)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.RunID != runID || cfg.InitialDir != run.Dir || !cfg.Shell {
+				t.Errorf("resumed run %s of %s with shell %t, want %s of %s with shell", cfg.RunID, cfg.InitialDir, cfg.Shell, runID, run.Dir)
+			}
+			if lines := cfg.CommandLines(); !slices.Equal(lines, run.Commands) {
+				t.Errorf("resumed commands %q, want %q", lines, run.Commands)
+			}
+		})
+	}
+}
+
+func TestLoadResumeProjectsNeedRunFile(t *testing.T) {
+	logDir := t.TempDir()
+	interruptRun(t, logDir, progress.JournalRun{
+		Dir:      "/srv/services",
+		Dirs:     []string{"api"},
+		Commands: []string{"node: npm test"},
+		Projects: true,
+	})
+	cfg := Config{LogDir: logDir}
+	if err := cfg.loadResume("", false); err == nil || !strings.Contains(err.Error(), "pass its run file with -f") {
+		t.Fatalf("got error %v, want the run file to be required", err)
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backoff strategies for the delay between retry attempts
+const (
+	BackoffConstant    = "constant"    // Always wait Delay
+	BackoffLinear      = "linear"      // Wait Delay, 2*Delay, 3*Delay...
+	BackoffExponential = "exponential" // Wait Delay, 2*Delay, 4*Delay...
+)
+
+// DefaultRetryDelay is the base delay between retry attempts when not configured
+const DefaultRetryDelay = time.Second
+
+// RetryPolicy decides whether a failed command attempt is retried and how long to wait first
+type RetryPolicy struct {
+	Retries     int              // Attempts allowed after the first one
+	Backoff     string           // BackoffConstant, BackoffLinear or BackoffExponential
+	Delay       time.Duration    // Base delay between attempts
+	MaxDelay    time.Duration    // Upper bound for the delay, 0 for none
+	Jitter      float64          // Fraction of the delay (0-1) randomly added or removed
+	OnExitCodes []int            // Only retry these exit codes (any when both conditions are empty)
+	OnStderr    []*regexp.Regexp // Only retry when stderr matches (any when both conditions are empty)
+	OnTimeout   bool             // Retry attempts that exceeded the step timeout
+}
+
+// DefaultRetryPolicy retries any failure with a linear backoff starting at one second
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Backoff: BackoffLinear, Delay: DefaultRetryDelay}
+}
+
+// Attempts returns the maximum number of attempts, including the first one
+func (p RetryPolicy) Attempts() int {
+	return p.Retries + 1
+}
+
+// ShouldRetry reports whether a failed attempt qualifies for a retry. exitCode is -1
+// when the command could not be started or was killed by a signal.
+func (p RetryPolicy) ShouldRetry(exitCode int, stderr string, timedOut bool) bool {
+	if timedOut {
+		return p.OnTimeout
+	}
+	if len(p.OnExitCodes) == 0 && len(p.OnStderr) == 0 {
+		return true
+	}
+	for _, code := range p.OnExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	for _, pattern := range p.OnStderr {
+		if pattern.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+// DelayBefore returns how long to wait before the given retry (1 for the first retry)
+func (p RetryPolicy) DelayBefore(retry int) time.Duration {
+	delay := float64(p.Delay)
+	switch p.Backoff {
+	case BackoffConstant:
+	case BackoffExponential:
+		delay *= math.Pow(2, float64(retry-1))
+	default:
+		delay *= float64(retry)
+	}
+
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(math.Max(delay, 0))
+}
+
+// RetryPolicyFor returns the retry policy of a command, falling back to the run-wide policy
+func (c *Config) RetryPolicyFor(command Command) RetryPolicy {
+	if command.Retry != nil {
+		return *command.Retry
+	}
+	return c.Retry
+}
+
+// validateBackoff reports an unknown backoff strategy
+func validateBackoff(backoff string) error {
+	switch backoff {
+	case BackoffConstant, BackoffLinear, BackoffExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown backoff %q (use %s, %s or %s)", backoff, BackoffConstant, BackoffLinear, BackoffExponential)
+}
+
+// ParseExitCodes parses a comma separated list of exit codes such as "1,128"
+func ParseExitCodes(input string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(input, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 0 {
+			return nil, fmt.Errorf("invalid exit code %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// compilePatterns compiles the stderr patterns of a retry policy
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
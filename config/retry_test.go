@@ -0,0 +1,77 @@
+package config
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	codes := RetryPolicy{OnExitCodes: []int{1, 128}}
+	stderr := RetryPolicy{OnStderr: []*regexp.Regexp{regexp.MustCompile(`(?i)connection reset|ETIMEDOUT`)}}
+	both := RetryPolicy{OnExitCodes: []int{128}, OnStderr: stderr.OnStderr}
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		exitCode int
+		stderr   string
+		timedOut bool
+		want     bool
+	}{
+		{"any failure", RetryPolicy{}, 2, "", false, true},
+		{"command not started", RetryPolicy{}, -1, "", false, true},
+		{"timeout not retried", RetryPolicy{}, -1, "", true, false},
+		{"timeout retried", RetryPolicy{OnTimeout: true}, -1, "", true, true},
+		{"timeout ignores exit codes", RetryPolicy{OnExitCodes: []int{1}, OnTimeout: true}, -1, "", true, true},
+		{"listed exit code", codes, 128, "", false, true},
+		{"unlisted exit code", codes, 2, "", false, false},
+		{"matching stderr", stderr, 1, "npm ERR! Connection Reset by peer", false, true},
+		{"other stderr", stderr, 1, "npm ERR! 404 Not Found", false, false},
+		{"exit code without stderr match", both, 128, "fatal", false, true},
+		{"stderr match with another exit code", both, 1, "read ETIMEDOUT", false, true},
+		{"neither condition", both, 1, "fatal", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.ShouldRetry(tt.exitCode, tt.stderr, tt.timedOut); got != tt.want {
+			t.Errorf("%s: ShouldRetry = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDelayBefore(t *testing.T) {
+	tests := []struct {
+		backoff  string
+		maxDelay time.Duration
+		want     []time.Duration // Delays before the first retries
+	}{
+		{BackoffConstant, 0, []time.Duration{time.Second, time.Second, time.Second}},
+		{BackoffLinear, 0, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{BackoffExponential, 0, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{BackoffExponential, 3 * time.Second, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		policy := RetryPolicy{Backoff: tt.backoff, Delay: time.Second, MaxDelay: tt.maxDelay}
+		for i, want := range tt.want {
+			if got := policy.DelayBefore(i + 1); got != want {
+				t.Errorf("%s backoff with max %s: delay before retry %d = %s, want %s", tt.backoff, tt.maxDelay, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestDelayBeforeJitter(t *testing.T) {
+	policy := RetryPolicy{Backoff: BackoffConstant, Delay: time.Second, Jitter: 0.25}
+	for range 100 {
+		if got := policy.DelayBefore(1); got < 750*time.Millisecond || got > 1250*time.Millisecond {
+			t.Fatalf("delay %s outside the jitter of 25%% around 1s", got)
+		}
+	}
+}
+
+func TestDelayBeforeOverflow(t *testing.T) {
+	policy := RetryPolicy{Backoff: BackoffExponential, Delay: time.Hour}
+	if got := policy.DelayBefore(100); got <= 0 {
+		t.Errorf("delay before retry 100 = %s, want a positive duration", got)
+	}
+}
@@ -0,0 +1,926 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gustavodamazio/mdir-run/directories"
+	"github.com/gustavodamazio/mdir-run/logger"
+)
+
+// RunFileVersion is the run file schema version written by EncodeRunFile and
+// the highest version LoadRunFile accepts
+const RunFileVersion = 1
+
+// runFile is the on-disk representation of a job
+type runFile struct {
+	Version          int               `yaml:"version" toml:"version"`
+	Dir              string            `yaml:"dir,omitempty" toml:"dir,omitempty"`
+	Shell            bool              `yaml:"shell,omitempty" toml:"shell,omitempty"`
+	ShellInterpreter string            `yaml:"shell_interpreter,omitempty" toml:"shell_interpreter,omitempty"`
+	Concurrency      int               `yaml:"concurrency,omitempty" toml:"concurrency,omitempty,omitzero"`
+	Retries          int               `yaml:"retries,omitempty" toml:"retries,omitempty,omitzero"`
+	GracePeriod      Duration          `yaml:"grace_period,omitempty" toml:"grace_period,omitempty,omitzero"`
+	StepTimeout      Duration          `yaml:"step_timeout,omitempty" toml:"step_timeout,omitempty,omitzero"`
+	DirTimeout       Duration          `yaml:"dir_timeout,omitempty" toml:"dir_timeout,omitempty,omitzero"`
+	RetryTimeouts    bool              `yaml:"retry_timeouts,omitempty" toml:"retry_timeouts,omitempty"`
+	FailFast         bool              `yaml:"fail_fast,omitempty" toml:"fail_fast,omitempty"`
+	MaxFailures      int               `yaml:"max_failures,omitempty" toml:"max_failures,omitempty,omitzero"`
+	MaxFailureRate   Rate              `yaml:"max_failure_rate,omitempty" toml:"max_failure_rate,omitempty,omitzero"`
+	AbortRunning     bool              `yaml:"abort_running,omitempty" toml:"abort_running,omitempty"`
+	Retry            *retrySpec        `yaml:"retry,omitempty" toml:"retry,omitempty"`
+	SubDirs          []string          `yaml:"subdirs,omitempty" toml:"subdirs,omitempty"`
+	Env              map[string]string `yaml:"env,omitempty" toml:"env,omitempty"`
+	DirsFrom         string            `yaml:"dirs_from,omitempty" toml:"dirs_from,omitempty"`
+	LogDir           string            `yaml:"log_dir,omitempty" toml:"log_dir,omitempty"`
+	ArchiveFormat    string            `yaml:"archive_format,omitempty" toml:"archive_format,omitempty"`
+	KeepRawLogs      bool              `yaml:"keep_raw_logs,omitempty" toml:"keep_raw_logs,omitempty"`
+	KeepRuns         int               `yaml:"keep_runs,omitempty" toml:"keep_runs,omitempty,omitzero"`
+	MaxLogAge        Age               `yaml:"max_log_age,omitempty" toml:"max_log_age,omitempty,omitzero"`
+	Filters          *filterSpec       `yaml:"filters,omitempty" toml:"filters,omitempty"`
+	Require          []string          `yaml:"require,omitempty" toml:"require,omitempty"`
+	Match            map[string]string `yaml:"match,omitempty" toml:"match,omitempty"`
+	Projects         []projectSpec     `yaml:"projects,omitempty" toml:"projects,omitempty"`
+	Steps            []stepSpec        `yaml:"steps,omitempty" toml:"steps,omitempty"`
+}
+
+// projectSpec is a project type detected by marker files, with its own steps
+type projectSpec struct {
+	Name    string            `yaml:"name" toml:"name"`
+	Require []string          `yaml:"require,omitempty" toml:"require,omitempty"`
+	Match   map[string]string `yaml:"match,omitempty" toml:"match,omitempty"`
+	Steps   []stepSpec        `yaml:"steps" toml:"steps"`
+}
+
+// filterSpec selects the directories to process
+type filterSpec struct {
+	Include     []string  `yaml:"include,omitempty" toml:"include,omitempty"`
+	Exclude     []string  `yaml:"exclude,omitempty" toml:"exclude,omitempty"`
+	Depth       int       `yaml:"depth,omitempty" toml:"depth,omitempty,omitzero"`
+	IgnoreFiles *[]string `yaml:"ignore_files,omitempty" toml:"ignore_files,omitempty"` // nil for the default
+	SkipHidden  bool      `yaml:"skip_hidden,omitempty" toml:"skip_hidden,omitempty"`
+	Parents     bool      `yaml:"parents,omitempty" toml:"parents,omitempty"`
+	Symlinks    string    `yaml:"symlinks,omitempty" toml:"symlinks,omitempty"`
+}
+
+// stepSpec is a step in a run file, written either as a plain command line
+// or as a mapping with a run key and per-step settings
+type stepSpec struct {
+	Run            string     `yaml:"run" toml:"run"`
+	Timeout        Duration   `yaml:"timeout,omitempty" toml:"timeout,omitempty,omitzero"`
+	Retries        *int       `yaml:"retries,omitempty" toml:"retries,omitempty"`
+	RetryOnTimeout *bool      `yaml:"retry_on_timeout,omitempty" toml:"retry_on_timeout,omitempty"`
+	Retry          *retrySpec `yaml:"retry,omitempty" toml:"retry,omitempty"`
+
+	ContinueOnError  bool  `yaml:"continue_on_error,omitempty" toml:"continue_on_error,omitempty"`
+	AlwaysRun        bool  `yaml:"always_run,omitempty" toml:"always_run,omitempty"`
+	AllowedExitCodes []int `yaml:"allowed_exit_codes,omitempty" toml:"allowed_exit_codes,omitempty"`
+}
+
+// retrySpec holds the backoff and retry conditions of a RetryPolicy.
+// Fields left unset keep the inherited value.
+type retrySpec struct {
+	Backoff     string    `yaml:"backoff,omitempty" toml:"backoff,omitempty"`
+	Delay       *Duration `yaml:"delay,omitempty" toml:"delay,omitempty"`
+	MaxDelay    *Duration `yaml:"max_delay,omitempty" toml:"max_delay,omitempty"`
+	Jitter      *float64  `yaml:"jitter,omitempty" toml:"jitter,omitempty"`
+	OnExitCodes []int     `yaml:"on_exit_codes,omitempty" toml:"on_exit_codes,omitempty"`
+	OnStderr    []string  `yaml:"on_stderr,omitempty" toml:"on_stderr,omitempty"`
+}
+
+// validate reports invalid retry settings found under path
+func (s *retrySpec) validate(fail func(message string, path ...string), path ...string) {
+	if s == nil {
+		return
+	}
+	at := func(field string, rest ...string) []string {
+		return append(append(append([]string{}, path...), field), rest...)
+	}
+
+	if s.Backoff != "" {
+		if err := validateBackoff(s.Backoff); err != nil {
+			fail(err.Error(), at("backoff")...)
+		}
+	}
+	if s.Delay != nil && *s.Delay < 0 {
+		fail("must not be negative", at("delay")...)
+	}
+	if s.MaxDelay != nil && *s.MaxDelay < 0 {
+		fail("must not be negative", at("max_delay")...)
+	}
+	if s.Jitter != nil && (*s.Jitter < 0 || *s.Jitter > 1) {
+		fail("must be between 0 and 1", at("jitter")...)
+	}
+	for i, code := range s.OnExitCodes {
+		if code < 0 {
+			fail("must not be negative", at("on_exit_codes", strconv.Itoa(i))...)
+		}
+	}
+	for i, pattern := range s.OnStderr {
+		if _, err := compilePatterns([]string{pattern}); err != nil {
+			fail(err.Error(), at("on_stderr", strconv.Itoa(i))...)
+		}
+	}
+}
+
+// apply overrides the fields of policy that are set in the spec
+func (s *retrySpec) apply(policy *RetryPolicy) error {
+	if s == nil {
+		return nil
+	}
+	if s.Backoff != "" {
+		policy.Backoff = s.Backoff
+	}
+	if s.Delay != nil {
+		policy.Delay = time.Duration(*s.Delay)
+	}
+	if s.MaxDelay != nil {
+		policy.MaxDelay = time.Duration(*s.MaxDelay)
+	}
+	if s.Jitter != nil {
+		policy.Jitter = *s.Jitter
+	}
+	if s.OnExitCodes != nil {
+		policy.OnExitCodes = s.OnExitCodes
+	}
+	if s.OnStderr != nil {
+		patterns, err := compilePatterns(s.OnStderr)
+		if err != nil {
+			return err
+		}
+		policy.OnStderr = patterns
+	}
+	return nil
+}
+
+// newRetrySpec describes the settings of policy that differ from base, or nil when none do
+func newRetrySpec(base, policy RetryPolicy) *retrySpec {
+	spec := &retrySpec{}
+	if policy.Backoff != base.Backoff {
+		spec.Backoff = policy.Backoff
+	}
+	if policy.Delay != base.Delay {
+		delay := Duration(policy.Delay)
+		spec.Delay = &delay
+	}
+	if policy.MaxDelay != base.MaxDelay {
+		maxDelay := Duration(policy.MaxDelay)
+		spec.MaxDelay = &maxDelay
+	}
+	if policy.Jitter != base.Jitter {
+		spec.Jitter = &policy.Jitter
+	}
+	if !reflect.DeepEqual(policy.OnExitCodes, base.OnExitCodes) {
+		spec.OnExitCodes = policy.OnExitCodes
+	}
+	if patterns := patternStrings(policy.OnStderr); !reflect.DeepEqual(patterns, patternStrings(base.OnStderr)) {
+		spec.OnStderr = patterns
+	}
+
+	if reflect.DeepEqual(spec, &retrySpec{}) {
+		return nil
+	}
+	return spec
+}
+
+func patternStrings(patterns []*regexp.Regexp) []string {
+	var sources []string
+	for _, pattern := range patterns {
+		sources = append(sources, pattern.String())
+	}
+	return sources
+}
+
+// stepFields mirrors stepSpec without its custom (un)marshalers
+type stepFields stepSpec
+
+func (s *stepSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&s.Run)
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: step must be a command line or a mapping", node.Line)
+	}
+
+	allowed := knownKeys(reflect.TypeOf(stepFields{}), "yaml")
+	for i := 0; i < len(node.Content); i += 2 {
+		if key := node.Content[i]; !allowed[key.Value] {
+			return fmt.Errorf("line %d: unknown step field %q", key.Line, key.Value)
+		}
+	}
+	return node.Decode((*stepFields)(s))
+}
+
+func (s stepSpec) MarshalYAML() (interface{}, error) {
+	if reflect.DeepEqual(s, stepSpec{Run: s.Run}) {
+		return s.Run, nil
+	}
+	return stepFields(s), nil
+}
+
+func (s *stepSpec) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		s.Run = v
+		return nil
+	case map[string]interface{}:
+		allowed := knownKeys(reflect.TypeOf(stepFields{}), "toml")
+		for key := range v {
+			if !allowed[key] {
+				return fmt.Errorf("unknown step field %q", key)
+			}
+		}
+		// Round-trip through the encoder so field types are checked by the decoder
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return err
+		}
+		_, err := toml.Decode(buf.String(), (*stepFields)(s))
+		return err
+	default:
+		return fmt.Errorf("step must be a command line or a table")
+	}
+}
+
+// knownKeys returns the field names declared by a struct tag
+func knownKeys(t reflect.Type, tag string) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// RunFileError describes a problem found in a run file
+type RunFileError struct {
+	File    string
+	Line    int // 0 when the line is unknown
+	Field   string
+	Message string
+}
+
+func (e *RunFileError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Message)
+}
+
+// positions resolves the line a field path was declared on
+type positions interface {
+	line(path ...string) int
+}
+
+// LoadRunFile reads a YAML (.yaml, .yml, .json) or TOML (.toml) run file into a Config
+func LoadRunFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run file: %w", err)
+	}
+	return ParseRunFile(data, path)
+}
+
+// ParseRunFile parses run file contents. The format is chosen from the extension of name,
+// which is also used in error messages and to resolve a relative dir.
+func ParseRunFile(data []byte, name string) (*Config, error) {
+	var rf runFile
+	var pos positions
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&rf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, &RunFileError{File: name, Message: "run file is empty"}
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pos = yamlPositions{root: &root}
+
+	case ".toml":
+		meta, err := toml.Decode(string(data), &rf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pos = newTOMLPositions(data)
+		var errs []error
+		for _, key := range meta.Undecoded() {
+			errs = append(errs, &RunFileError{File: name, Line: pos.line(key...), Field: key.String(), Message: "unknown field"})
+		}
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: unsupported run file format (use .yaml, .yml, .json or .toml)", name)
+	}
+
+	if rf.Filters == nil {
+		rf.Filters = &filterSpec{}
+	}
+	if err := rf.validate(name, pos); err != nil {
+		return nil, err
+	}
+	return rf.toConfig(name)
+}
+
+// validate checks the run file schema and reports every problem found
+func (rf *runFile) validate(name string, pos positions) error {
+	var errs []error
+	fail := func(message string, path ...string) {
+		errs = append(errs, &RunFileError{File: name, Line: pos.line(path...), Field: displayPath(path), Message: message})
+	}
+
+	switch {
+	case rf.Version == 0:
+		fail(fmt.Sprintf("is required (current version is %d)", RunFileVersion), "version")
+	case rf.Version < 0 || rf.Version > RunFileVersion:
+		fail(fmt.Sprintf("unsupported version %d (supported up to %d)", rf.Version, RunFileVersion), "version")
+	}
+
+	if rf.Concurrency < 0 {
+		fail("must be at least 1", "concurrency")
+	}
+	if rf.Retries < 0 {
+		fail("must not be negative", "retries")
+	}
+	rf.Retry.validate(fail, "retry")
+	if rf.GracePeriod < 0 {
+		fail("must not be negative", "grace_period")
+	}
+	if rf.StepTimeout < 0 {
+		fail("must not be negative", "step_timeout")
+	}
+	if rf.DirTimeout < 0 {
+		fail("must not be negative", "dir_timeout")
+	}
+	if rf.MaxFailures < 0 {
+		fail("must not be negative", "max_failures")
+	}
+	if _, err := ParseInterpreter(rf.ShellInterpreter); err != nil {
+		fail(err.Error(), "shell_interpreter")
+	}
+	if err := logger.ValidateArchiveFormat(rf.ArchiveFormat); err != nil {
+		fail(err.Error(), "archive_format")
+	}
+	if rf.KeepRuns < 0 {
+		fail("must not be negative", "keep_runs")
+	}
+	for key := range rf.Env {
+		if !isVariableName(key) {
+			fail("invalid variable name", "env", key)
+		}
+	}
+	for i, pattern := range rf.Filters.Include {
+		if !doublestar.ValidatePattern(pattern) {
+			fail(fmt.Sprintf("invalid pattern %q", pattern), "filters", "include", strconv.Itoa(i))
+		}
+	}
+	for i, pattern := range rf.Filters.Exclude {
+		if !doublestar.ValidatePattern(pattern) {
+			fail(fmt.Sprintf("invalid pattern %q", pattern), "filters", "exclude", strconv.Itoa(i))
+		}
+	}
+	if rf.Filters.Depth < 0 {
+		fail("must be at least 1", "filters", "depth")
+	}
+	if err := directories.ValidateSymlinks(rf.Filters.Symlinks); err != nil {
+		fail(err.Error(), "filters", "symlinks")
+	}
+
+	rf.validateMarkers(fail, rf.Require, rf.Match)
+	if len(rf.Steps) == 0 && len(rf.Projects) == 0 {
+		fail("at least one step or project is required", "steps")
+	}
+	rf.validateSteps(fail, rf.Steps, "steps")
+
+	names := make(map[string]bool)
+	for i, project := range rf.Projects {
+		index := strconv.Itoa(i)
+		switch {
+		case strings.TrimSpace(project.Name) == "":
+			fail("is required", "projects", index, "name")
+		case names[project.Name]:
+			fail(fmt.Sprintf("duplicate project %q", project.Name), "projects", index, "name")
+		}
+		names[project.Name] = true
+		if len(project.Require) == 0 && len(project.Match) == 0 {
+			fail("require or match is needed to detect the project", "projects", index)
+		}
+		rf.validateMarkers(fail, project.Require, project.Match, "projects", index)
+		if len(project.Steps) == 0 {
+			fail("at least one step is required", "projects", index, "steps")
+		}
+		rf.validateSteps(fail, project.Steps, "projects", index, "steps")
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSteps reports invalid steps found under path
+func (rf *runFile) validateSteps(fail func(message string, path ...string), steps []stepSpec, path ...string) {
+	at := func(rest ...string) []string {
+		return append(append([]string{}, path...), rest...)
+	}
+	for i, step := range steps {
+		index := strconv.Itoa(i)
+		if step.Timeout < 0 {
+			fail("must not be negative", at(index, "timeout")...)
+		}
+		if step.Retries != nil && *step.Retries < 0 {
+			fail("must not be negative", at(index, "retries")...)
+		}
+		step.Retry.validate(fail, at(index, "retry")...)
+		for j, code := range step.AllowedExitCodes {
+			if code < 0 {
+				fail("must not be negative", at(index, "allowed_exit_codes", strconv.Itoa(j))...)
+			}
+		}
+		if strings.TrimSpace(step.Run) == "" {
+			fail("command must not be empty", at(index)...)
+			continue
+		}
+		if !rf.Shell {
+			if _, err := SplitArgs(step.Run, rf.lookupEnv); err != nil {
+				fail(err.Error(), at(index)...)
+			}
+		}
+	}
+}
+
+// validateMarkers reports invalid require and match conditions found under path
+func (rf *runFile) validateMarkers(fail func(message string, path ...string), require []string, match map[string]string, path ...string) {
+	at := func(rest ...string) []string {
+		return append(append([]string{}, path...), rest...)
+	}
+	for i, pattern := range require {
+		if !doublestar.ValidatePattern(pattern) {
+			fail(fmt.Sprintf("invalid file pattern %q", pattern), at("require", strconv.Itoa(i))...)
+		}
+	}
+	for file, pattern := range match {
+		if _, err := directories.NewContentMatch(file, pattern); err != nil {
+			fail(err.Error(), at("match", file)...)
+		}
+	}
+}
+
+// lookupEnv resolves variables from the run file env, then from the process environment
+func (rf *runFile) lookupEnv(name string) string {
+	if value, ok := rf.Env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// toConfig converts a validated run file into a Config
+func (rf *runFile) toConfig(name string) (*Config, error) {
+	cfg := &Config{
+		InitialDir:         expandDir(rf.Dir, filepath.Dir(name)),
+		DirsFrom:           rf.DirsFrom,
+		LogDir:             expandDir(rf.LogDir, filepath.Dir(name)),
+		ArchiveFormat:      rf.ArchiveFormat,
+		KeepRawLogs:        rf.KeepRawLogs,
+		KeepRuns:           rf.KeepRuns,
+		MaxLogAge:          time.Duration(rf.MaxLogAge),
+		Concurrency:        rf.Concurrency,
+		SubDirsEntryPoints: rf.SubDirs,
+		Shell:              rf.Shell,
+		StepTimeout:        time.Duration(rf.StepTimeout),
+		DirTimeout:         time.Duration(rf.DirTimeout),
+		FailFast:           rf.FailFast,
+		MaxFailures:        rf.MaxFailures,
+		MaxFailureRate:     float64(rf.MaxFailureRate),
+		AbortRunning:       rf.AbortRunning,
+		IncludeDirs:        rf.Filters.Include,
+		ExcludeDirs:        rf.Filters.Exclude,
+		Depth:              rf.Filters.Depth,
+		IgnoreFiles:        []string{directories.DefaultIgnoreFile},
+		SkipHidden:         rf.Filters.SkipHidden,
+		Parents:            rf.Filters.Parents,
+		Symlinks:           rf.Filters.Symlinks,
+	}
+	if cfg.DirsFrom != "" && cfg.DirsFrom != "-" {
+		cfg.DirsFrom = expandDir(cfg.DirsFrom, filepath.Dir(name))
+	}
+	if cfg.Depth == 0 {
+		cfg.Depth = 1
+	}
+	if rf.Filters.IgnoreFiles != nil {
+		cfg.IgnoreFiles = *rf.Filters.IgnoreFiles
+	}
+	if cfg.Symlinks == "" {
+		cfg.Symlinks = directories.SymlinkSkip
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	cfg.GracePeriod = time.Duration(rf.GracePeriod)
+	if cfg.GracePeriod == 0 {
+		cfg.GracePeriod = DefaultGracePeriod
+	}
+
+	cfg.Retry = DefaultRetryPolicy()
+	cfg.Retry.Retries = rf.Retries
+	cfg.Retry.OnTimeout = rf.RetryTimeouts
+	if err := rf.Retry.apply(&cfg.Retry); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(rf.Env))
+	for key := range rf.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cfg.Env = append(cfg.Env, key+"="+rf.Env[key])
+	}
+
+	interpreter, err := ParseInterpreter(rf.ShellInterpreter)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ShellInterpreter = interpreter
+
+	if cfg.Commands, err = toCommands(rf.Steps, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Require, err = toMarkers(rf.Require, rf.Match); err != nil {
+		return nil, err
+	}
+	for _, spec := range rf.Projects {
+		project := Project{Name: spec.Name}
+		if project.Markers, err = toMarkers(spec.Require, spec.Match); err != nil {
+			return nil, err
+		}
+		if project.Commands, err = toCommands(spec.Steps, cfg); err != nil {
+			return nil, err
+		}
+		cfg.Projects = append(cfg.Projects, project)
+	}
+	return cfg, nil
+}
+
+// toCommands converts validated steps into tokenized commands
+func toCommands(steps []stepSpec, cfg *Config) ([]Command, error) {
+	var commands []Command
+	for _, step := range steps {
+		command := Command{
+			Line:             strings.TrimSpace(step.Run),
+			Timeout:          time.Duration(step.Timeout),
+			ContinueOnError:  step.ContinueOnError,
+			AlwaysRun:        step.AlwaysRun,
+			AllowedExitCodes: step.AllowedExitCodes,
+		}
+
+		// Steps with their own retry settings get a policy derived from the run-wide one
+		if step.Retries != nil || step.RetryOnTimeout != nil || step.Retry != nil {
+			policy := cfg.Retry
+			if step.Retries != nil {
+				policy.Retries = *step.Retries
+			}
+			if step.RetryOnTimeout != nil {
+				policy.OnTimeout = *step.RetryOnTimeout
+			}
+			if err := step.Retry.apply(&policy); err != nil {
+				return nil, err
+			}
+			command.Retry = &policy
+		}
+		commands = append(commands, command)
+	}
+	return tokenizeCommands(commands, cfg.Shell, cfg.LookupEnv)
+}
+
+// toMarkers converts validated require and match conditions, sorting match by file
+func toMarkers(require []string, match map[string]string) (directories.Markers, error) {
+	markers := directories.Markers{Require: require}
+	files := make([]string, 0, len(match))
+	for file := range match {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		condition, err := directories.NewContentMatch(file, match[file])
+		if err != nil {
+			return directories.Markers{}, err
+		}
+		markers.Match = append(markers.Match, condition)
+	}
+	return markers, nil
+}
+
+// expandDir expands a leading ~ and resolves a relative dir against base
+func expandDir(dir, base string) string {
+	if dir == "" {
+		return ""
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[1:])
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		if absBase, err := filepath.Abs(base); err == nil {
+			dir = filepath.Join(absBase, dir)
+		}
+	}
+	return dir
+}
+
+// EncodeRunFile renders a Config as a run file, choosing the format from the extension of name
+func EncodeRunFile(cfg *Config, name string) ([]byte, error) {
+	rf := runFile{
+		Version:        RunFileVersion,
+		Dir:            cfg.InitialDir,
+		DirsFrom:       cfg.DirsFrom,
+		LogDir:         cfg.LogDir,
+		ArchiveFormat:  cfg.ArchiveFormat,
+		KeepRawLogs:    cfg.KeepRawLogs,
+		KeepRuns:       cfg.KeepRuns,
+		MaxLogAge:      Age(cfg.MaxLogAge),
+		Shell:          cfg.Shell,
+		Concurrency:    cfg.Concurrency,
+		Retries:        cfg.Retry.Retries,
+		SubDirs:        cfg.SubDirsEntryPoints,
+		StepTimeout:    Duration(cfg.StepTimeout),
+		DirTimeout:     Duration(cfg.DirTimeout),
+		FailFast:       cfg.FailFast,
+		MaxFailures:    cfg.MaxFailures,
+		MaxFailureRate: Rate(cfg.MaxFailureRate),
+		AbortRunning:   cfg.AbortRunning,
+		RetryTimeouts:  cfg.Retry.OnTimeout,
+		Retry:          newRetrySpec(DefaultRetryPolicy(), cfg.Retry),
+	}
+	if cfg.GracePeriod != DefaultGracePeriod {
+		rf.GracePeriod = Duration(cfg.GracePeriod)
+	}
+
+	filters := filterSpec{Include: cfg.IncludeDirs, Exclude: cfg.ExcludeDirs, SkipHidden: cfg.SkipHidden, Parents: cfg.Parents}
+	if cfg.Depth > 1 {
+		filters.Depth = cfg.Depth
+	}
+	if !reflect.DeepEqual(cfg.IgnoreFiles, []string{directories.DefaultIgnoreFile}) {
+		ignoreFiles := append([]string{}, cfg.IgnoreFiles...)
+		filters.IgnoreFiles = &ignoreFiles
+	}
+	if cfg.Symlinks != directories.SymlinkSkip {
+		filters.Symlinks = cfg.Symlinks
+	}
+	if !reflect.DeepEqual(filters, filterSpec{}) {
+		rf.Filters = &filters
+	}
+	if cfg.Shell && len(cfg.ShellInterpreter) > 0 && !reflect.DeepEqual(cfg.ShellInterpreter, DefaultShellInterpreter()) {
+		rf.ShellInterpreter = JoinArgs(cfg.ShellInterpreter)
+	}
+	for _, entry := range cfg.Env {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			if rf.Env == nil {
+				rf.Env = make(map[string]string)
+			}
+			rf.Env[key] = value
+		}
+	}
+	rf.Steps = newStepSpecs(cfg.Commands, cfg.Retry)
+	rf.Require, rf.Match = newMarkerSpecs(cfg.Require)
+	for _, project := range cfg.Projects {
+		spec := projectSpec{Name: project.Name, Steps: newStepSpecs(project.Commands, cfg.Retry)}
+		spec.Require, spec.Match = newMarkerSpecs(project.Markers)
+		rf.Projects = append(rf.Projects, spec)
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(rf); err != nil {
+			return nil, fmt.Errorf("failed to encode run file: %w", err)
+		}
+	case ".toml":
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(rf); err != nil {
+			return nil, fmt.Errorf("failed to encode run file: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported run file format (use .yaml, .yml or .toml)", name)
+	}
+	return buf.Bytes(), nil
+}
+
+// newStepSpecs converts commands into steps, keeping only settings that differ from the run-wide retry policy
+func newStepSpecs(commands []Command, retry RetryPolicy) []stepSpec {
+	var steps []stepSpec
+	for _, command := range commands {
+		step := stepSpec{
+			Run:              command.Line,
+			Timeout:          Duration(command.Timeout),
+			ContinueOnError:  command.ContinueOnError,
+			AlwaysRun:        command.AlwaysRun,
+			AllowedExitCodes: command.AllowedExitCodes,
+		}
+		if policy := command.Retry; policy != nil {
+			if policy.Retries != retry.Retries {
+				step.Retries = &policy.Retries
+			}
+			if policy.OnTimeout != retry.OnTimeout {
+				step.RetryOnTimeout = &policy.OnTimeout
+			}
+			step.Retry = newRetrySpec(retry, *policy)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// newMarkerSpecs converts markers into require and match conditions
+func newMarkerSpecs(markers directories.Markers) ([]string, map[string]string) {
+	var match map[string]string
+	for _, condition := range markers.Match {
+		if match == nil {
+			match = make(map[string]string)
+		}
+		match[condition.File] = condition.Pattern.String()
+	}
+	return markers.Require, match
+}
+
+// SaveRunFile writes a Config to path as a run file
+func SaveRunFile(cfg *Config, path string) error {
+	data, err := EncodeRunFile(cfg, path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run file: %w", err)
+	}
+	return nil
+}
+
+// displayPath formats a field path as steps[2].run
+func displayPath(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		if _, err := strconv.Atoi(segment); err == nil {
+			fmt.Fprintf(&b, "[%s]", segment)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// yamlPositions resolves field lines from the parsed YAML node tree
+type yamlPositions struct {
+	root *yaml.Node
+}
+
+func (p yamlPositions) line(path ...string) int {
+	if p.root == nil || len(p.root.Content) == 0 {
+		return 0
+	}
+	node := p.root.Content[0]
+	line := node.Line
+	for _, segment := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if index, err := strconv.Atoi(segment); err == nil && index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+		line = node.Line
+	}
+	return line
+}
+
+// tomlPositions maps dotted field paths to the line they were first declared on.
+// The TOML decoder does not expose key positions, so table headers and key/value
+// lines are scanned directly; fields without their own line resolve to their parent.
+// Paths inside arrays of tables carry the index of every enclosing table, e.g.
+// projects.1.steps.0.run, and are also recorded without indices, as the decoder reports
+// undecoded keys.
+type tomlPositions map[string]int
+
+func newTOMLPositions(data []byte) tomlPositions {
+	pos := make(tomlPositions)
+	var table, names []string           // Current table, with and without array indices
+	arrayCounts := make(map[string]int) // Tables seen in every array of tables, by indexed path
+
+	record := func(path []string, line int) {
+		key := strings.Join(path, ".")
+		if _, ok := pos[key]; !ok {
+			pos[key] = line
+		}
+	}
+	join := func(path []string, rest ...string) []string {
+		return append(append([]string{}, path...), rest...)
+	}
+
+	// resolve inserts the current index of every enclosing array of tables into a header key,
+	// e.g. projects.steps becomes projects.1 and steps within the second [[projects]]
+	resolve := func(key []string) []string {
+		var path []string
+		for _, segment := range key {
+			path = append(path, segment)
+			if count, ok := arrayCounts[strings.Join(path, ".")]; ok {
+				path = append(path, strconv.Itoa(count-1))
+			}
+		}
+		return path
+	}
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[["):
+			end := strings.Index(line, "]]")
+			if end < 0 {
+				continue
+			}
+			names = splitTOMLKey(line[2:end])
+			array := join(resolve(names[:len(names)-1]), names[len(names)-1])
+			index := arrayCounts[strings.Join(array, ".")]
+			arrayCounts[strings.Join(array, ".")]++
+			table = join(array, strconv.Itoa(index))
+			record(array, i+1)
+			record(table, i+1)
+			record(names, i+1)
+		case strings.HasPrefix(line, "["):
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			names = splitTOMLKey(line[1:end])
+			table = resolve(names)
+			record(table, i+1)
+			record(names, i+1)
+		default:
+			if eq := strings.Index(line, "="); eq > 0 {
+				key := splitTOMLKey(line[:eq])
+				record(join(table, key...), i+1)
+				record(join(names, key...), i+1)
+			}
+		}
+	}
+	return pos
+}
+
+func (p tomlPositions) line(path ...string) int {
+	for n := len(path); n > 0; n-- {
+		if line, ok := p[strings.Join(path[:n], ".")]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+func splitTOMLKey(key string) []string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return parts
+}
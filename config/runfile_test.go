@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// runFileErrors returns the problems reported by ParseRunFile
+func runFileErrors(t *testing.T, err error) []*RunFileError {
+	t.Helper()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	var found []*RunFileError
+	for _, err := range errs {
+		var runFileErr *RunFileError
+		if !errors.As(err, &runFileErr) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		found = append(found, runFileErr)
+	}
+	return found
+}
+
+func TestRunFileErrorPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string // Field:line of every problem, in any order
+	}{
+		{
+			name: "missing.yaml",
+			data: "steps: [make]\n",
+			want: []string{"version:1"},
+		},
+		{
+			name: "values.yaml",
+			data: `version: 1
+concurrency: -1
+env:
+  1BAD: x
+filters:
+  include: ["src/*", "[unclosed"]
+steps:
+  - make
+  - run: make test
+    timeout: -5s
+  - ls | wc -l
+`,
+			want: []string{"concurrency:2", "env.1BAD:4", "filters.include[1]:6", "steps[1].timeout:10", "steps[2]:11"},
+		},
+		{
+			name: "projects.yml",
+			data: `version: 1
+projects:
+  - name: node
+    require: [package.json]
+    steps: [npm test]
+  - name: node
+    match:
+      go.mod: "("
+    steps: []
+`,
+			want: []string{"projects[1].name:6", "projects[1].match.go.mod:8", "projects[1].steps:9"},
+		},
+		{
+			name: "values.toml",
+			data: `version = 1
+concurrency = -1
+steps = ["make", "ls | wc -l"]
+
+[env]
+1BAD = "x"
+
+[filters]
+include = ["src/*", "[unclosed"]
+`,
+			want: []string{"concurrency:2", "steps[1]:3", "env.1BAD:6", "filters.include[1]:9"},
+		},
+		{
+			name: "projects.toml",
+			data: `version = 1
+
+[[projects]]
+name = "node"
+require = ["package.json"]
+steps = ["npm test"]
+
+[[projects]]
+name = "node"
+steps = []
+
+[projects.match]
+"go.mod" = "("
+`,
+			want: []string{"projects[1].name:9", "projects[1].steps:10", "projects[1].match.go.mod:13"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRunFile([]byte(tt.data), tt.name)
+			var got []string
+			for _, e := range runFileErrors(t, err) {
+				if e.File != tt.name {
+					t.Errorf("%v reported in %s", e, e.File)
+				}
+				got = append(got, fmt.Sprintf("%s:%d", e.Field, e.Line))
+			}
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTOMLPositionsInNestedArrays(t *testing.T) {
+	data := `version = 1
+
+[[projects]]
+name = "node"
+require = ["package.json"]
+
+[[projects.steps]]
+run = "npm ci"
+
+[[projects.steps]]
+run = "npm test"
+retries = -1
+
+[[projects]]
+name = "go"
+require = ["go.mod"]
+
+[[projects.steps]]
+run = "go build ./..."
+timeout = "-1s"
+
+[[projects.steps]]
+run = "go test ./..."
+retries = -2
+`
+	_, err := ParseRunFile([]byte(data), "job.toml")
+	errs := runFileErrors(t, err)
+
+	want := map[string]int{
+		"projects[0].steps[1].retries": 12,
+		"projects[1].steps[0].timeout": 20,
+		"projects[1].steps[1].retries": 24,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), err)
+	}
+	for _, e := range errs {
+		line, ok := want[e.Field]
+		if !ok {
+			t.Errorf("unexpected error %v", e)
+			continue
+		}
+		if e.Line != line {
+			t.Errorf("%s reported on line %d, want %d", e.Field, e.Line, line)
+		}
+	}
+}
+
+func TestTOMLUnknownFieldInNestedArray(t *testing.T) {
+	data := `version = 1
+
+[[projects]]
+name = "node"
+require = ["package.json"]
+steps = ["npm ci"]
+
+[[projects]]
+name = "go"
+require = ["go.mod"]
+steps = ["go test ./..."]
+descripton = "Go modules"
+`
+	_, err := ParseRunFile([]byte(data), "job.toml")
+	errs := runFileErrors(t, err)
+	if len(errs) != 1 || errs[0].Field != "projects.descripton" || errs[0].Line != 12 {
+		t.Fatalf("got %v, want projects.descripton on line 12", err)
+	}
+}
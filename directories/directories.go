@@ -3,6 +3,7 @@ package directories
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 func GetDirectories(initialDir string) ([]string, error) {
@@ -20,3 +21,42 @@ func GetDirectories(initialDir string) ([]string, error) {
 
 	return dirs, nil
 }
+
+// FilterDirectories keeps directories matching at least one include pattern (all when
+// include is empty) and none of the exclude patterns. Patterns use the same doublestar
+// syntax as Discover.
+func FilterDirectories(dirs []string, include, exclude []string) ([]string, error) {
+	var filtered []string
+	for _, dir := range dirs {
+		included := len(include) == 0
+		for _, pattern := range include {
+			matched, err := matchPattern(pattern, filepath.ToSlash(dir))
+			if err != nil {
+				return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+			}
+			if matched {
+				included = true
+				break
+			}
+		}
+		if !included {
+			continue
+		}
+
+		excluded := false
+		for _, pattern := range exclude {
+			matched, err := matchPattern(pattern, filepath.ToSlash(dir))
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+			if matched {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, dir)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,199 @@
+package directories
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Symlink policies for directories reached through a symbolic link
+const (
+	SymlinkSkip    = "skip"    // Ignore symlinked directories
+	SymlinkInclude = "include" // Select symlinked directories without descending into them
+	SymlinkFollow  = "follow"  // Select and descend into symlinked directories, each target once
+)
+
+// DefaultIgnoreFile is the ignore file read in every visited directory when none is configured
+const DefaultIgnoreFile = ".mdirignore"
+
+// Options control which directories Discover selects
+type Options struct {
+	Depth       int       // Levels below the root to look at, 1 for direct children only
+	Include     []string  // Select directories matching one of these patterns, all when empty
+	Exclude     []string  // Skip directories matching one of these patterns, with everything below them
+	IgnoreFiles []string  // Names of .gitignore-style files read in every visited directory
+	SkipHidden  bool      // Leave out directories whose name starts with a dot
+	Parents     bool      // Also select directories that have selected directories below them
+	Symlinks    string    // SymlinkSkip, SymlinkInclude or SymlinkFollow
+	Markers     Markers   // Only select directories satisfying these conditions
+	AnyOf       []Markers // Only select directories satisfying at least one of these, when set
+}
+
+// ValidateSymlinks reports an unknown symlink policy
+func ValidateSymlinks(policy string) error {
+	switch policy {
+	case "", SymlinkSkip, SymlinkInclude, SymlinkFollow:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink policy %q (use %s, %s or %s)", policy, SymlinkSkip, SymlinkInclude, SymlinkFollow)
+}
+
+// Discover walks root up to opts.Depth levels and returns the selected directories
+// as sorted paths relative to root. Include and exclude patterns use doublestar syntax
+// (** matches any number of directories) on slash separated paths. Unless opts.Parents
+// is set, only the deepest selected directories are returned: a directory with a selected
+// directory below it is left out, so that a single level selects the direct children.
+func Discover(root string, opts Options) ([]string, error) {
+	if opts.Depth < 1 {
+		opts.Depth = 1
+	}
+	if err := ValidateSymlinks(opts.Symlinks); err != nil {
+		return nil, err
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := matchPattern(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, markers := range append([]Markers{opts.Markers}, opts.AnyOf...) {
+		if err := markers.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &walker{root: root, opts: opts, visited: make(map[string]bool)}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		w.visited[resolved] = true
+	}
+	if err := w.walk("", 1, nil); err != nil {
+		return nil, err
+	}
+
+	dirs := w.dirs
+	if !opts.Parents {
+		dirs = deepest(dirs)
+	}
+	sort.Strings(dirs)
+	for i, dir := range dirs {
+		dirs[i] = filepath.FromSlash(dir)
+	}
+	return dirs, nil
+}
+
+// deepest returns the slash paths of dirs that have none of the others below them
+func deepest(dirs []string) []string {
+	parents := make(map[string]bool)
+	for _, dir := range dirs {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			parents[parent] = true
+		}
+	}
+	var leaves []string
+	for _, dir := range dirs {
+		if !parents[dir] {
+			leaves = append(leaves, dir)
+		}
+	}
+	return leaves
+}
+
+type walker struct {
+	root    string
+	opts    Options
+	visited map[string]bool // Resolved paths of followed directories, to avoid symlink cycles
+	dirs    []string
+}
+
+// walk visits the children of rel, a slash path relative to the root
+func (w *walker) walk(rel string, depth int, rules []ignoreRule) error {
+	dir := filepath.Join(w.root, filepath.FromSlash(rel))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if rel == "" {
+			return fmt.Errorf("failed to read directory %s: %w", dir, err)
+		}
+		return nil // Unreadable nested directories are left out
+	}
+
+	for _, name := range w.opts.IgnoreFiles {
+		loaded, err := loadIgnoreFile(filepath.Join(dir, name), rel)
+		if err != nil {
+			return err
+		}
+		// Copy so sibling directories do not share appended rules
+		rules = append(append([]ignoreRule{}, rules...), loaded...)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && w.opts.SkipHidden {
+			continue
+		}
+
+		descend := depth < w.opts.Depth
+		if entry.Type()&os.ModeSymlink != 0 {
+			if w.opts.Symlinks != SymlinkInclude && w.opts.Symlinks != SymlinkFollow {
+				continue
+			}
+			target := filepath.Join(dir, name)
+			if stat, err := os.Stat(target); err != nil || !stat.IsDir() {
+				continue
+			}
+			descend = descend && w.opts.Symlinks == SymlinkFollow
+		} else if !entry.IsDir() {
+			continue
+		}
+
+		child := path.Join(rel, name)
+		if ignored(rules, child) || w.matchesAny(w.opts.Exclude, child) {
+			continue
+		}
+		if len(w.opts.Include) == 0 || w.matchesAny(w.opts.Include, child) {
+			selected, err := w.hasMarkers(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			if selected {
+				w.dirs = append(w.dirs, child)
+			}
+		}
+
+		if descend {
+			resolved, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+			if err != nil || w.visited[resolved] {
+				continue
+			}
+			w.visited[resolved] = true
+			if err := w.walk(child, depth+1, rules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *walker) matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		// Patterns were validated by Discover
+		if matched, _ := matchPattern(pattern, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMarkers reports whether dir satisfies the marker conditions of the options
+func (w *walker) hasMarkers(dir string) (bool, error) {
+	if matched, err := w.opts.Markers.Matches(dir); err != nil || !matched {
+		return false, err
+	}
+	for _, markers := range w.opts.AnyOf {
+		if matched, err := markers.Matches(dir); err != nil || matched {
+			return matched, err
+		}
+	}
+	return len(w.opts.AnyOf) == 0, nil
+}
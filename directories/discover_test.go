@@ -0,0 +1,168 @@
+package directories
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testTree creates a directory tree with ignore files, a hidden directory, a file, a
+// symlink to libs and a symlink to a directory outside the tree, and returns its root
+func testTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"api", "web/src", "libs/core", "libs/util", "vendor/pkg", ".git/hooks", "node_modules/left-pad"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"README.md":        "# services\n",
+		DefaultIgnoreFile:  "# Third-party code\nvendor/\n",
+		"libs/.mdirignore": "util\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libs", filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	tools := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tools, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(tools, filepath.Join(root, "tools")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestDiscover(t *testing.T) {
+	root := testTree(t)
+	ignoreFiles := []string{DefaultIgnoreFile}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "direct children",
+			opts: Options{IgnoreFiles: ignoreFiles},
+			want: []string{".git", "api", "libs", "node_modules", "web"},
+		},
+		{
+			name: "without ignore files",
+			opts: Options{},
+			want: []string{".git", "api", "libs", "node_modules", "vendor", "web"},
+		},
+		{
+			name: "hidden directories skipped",
+			opts: Options{IgnoreFiles: ignoreFiles, SkipHidden: true},
+			want: []string{"api", "libs", "node_modules", "web"},
+		},
+		{
+			name: "deepest directories",
+			opts: Options{Depth: 2, IgnoreFiles: ignoreFiles, Exclude: []string{"node_modules"}},
+			want: []string{".git/hooks", "api", "libs/core", "web/src"},
+		},
+		{
+			name: "parents",
+			opts: Options{Depth: 2, IgnoreFiles: ignoreFiles, Exclude: []string{"node_modules"}, SkipHidden: true, Parents: true},
+			want: []string{"api", "libs", "libs/core", "web", "web/src"},
+		},
+		{
+			name: "include with a slash matches the whole path",
+			opts: Options{Depth: 2, IgnoreFiles: ignoreFiles, Include: []string{"libs/*"}},
+			want: []string{"libs/core"},
+		},
+		{
+			name: "include without a slash matches the name at any depth",
+			opts: Options{Depth: 3, Include: []string{"src", "u*"}},
+			want: []string{"libs/util", "web/src"},
+		},
+		{
+			name: "parent selected when nothing below it is",
+			opts: Options{Depth: 2, IgnoreFiles: ignoreFiles, Include: []string{"libs", "web/*"}},
+			want: []string{"libs", "web/src"},
+		},
+		{
+			name: "double star",
+			opts: Options{Depth: 3, Include: []string{"**/left-*"}},
+			want: []string{"node_modules/left-pad"},
+		},
+		{
+			name: "exclude skips everything below",
+			opts: Options{Depth: 3, Exclude: []string{".git", "libs", "vendor", "node_modules", "web"}},
+			want: []string{"api"},
+		},
+		{
+			name: "symlinks skipped",
+			opts: Options{Depth: 2, Include: []string{"tools", "tools/*"}, Symlinks: SymlinkSkip},
+			want: nil,
+		},
+		{
+			name: "symlinks included without descending",
+			opts: Options{Depth: 2, Include: []string{"tools", "tools/*"}, Symlinks: SymlinkInclude},
+			want: []string{"tools"},
+		},
+		{
+			name: "symlinks followed",
+			opts: Options{Depth: 2, Include: []string{"tools", "tools/*"}, Symlinks: SymlinkFollow, Parents: true},
+			want: []string{"tools", "tools/bin"},
+		},
+		{
+			name: "symlink targets followed once",
+			opts: Options{Depth: 2, IgnoreFiles: ignoreFiles, Include: []string{"li*", "li*/*"}, Symlinks: SymlinkFollow, Parents: true},
+			want: []string{"libs", "libs/core", "link"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Discover(root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, dir := range tt.want {
+				want = append(want, filepath.FromSlash(dir))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDiscoverFollowsSymlinkCyclesOnce(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "a", "up")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	got, err := Discover(root, Options{Depth: 10, Symlinks: SymlinkFollow, Parents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", filepath.Join("a", "up")}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiscoverInvalidOptions(t *testing.T) {
+	root := t.TempDir()
+	for _, opts := range []Options{
+		{Include: []string{"[unclosed"}},
+		{Exclude: []string{"a/[b"}},
+		{Symlinks: "sometimes"},
+	} {
+		if _, err := Discover(root, opts); err == nil {
+			t.Errorf("Discover with %+v succeeded", opts)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package directories
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreRule is a single line of a .gitignore-style file
+type ignoreRule struct {
+	base    string // Slash path of the directory holding the ignore file, relative to the root
+	pattern string // Pattern relative to base, ** is prepended to unanchored patterns
+	negate  bool   // Line started with !, re-including matching directories
+}
+
+// loadIgnoreFile reads the rules of an ignore file located in the base directory.
+// A missing file yields no rules.
+func loadIgnoreFile(file, base string) ([]ignoreRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read ignore file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(text, "!") {
+			rule.negate = true
+			text = text[1:]
+		}
+		text = strings.TrimPrefix(text, `\`) // \# and \! escape a leading # or !
+		text = strings.TrimSuffix(text, "/") // Only directories are matched anyway
+
+		// Patterns without an inner slash match at any depth below the ignore file
+		if strings.HasPrefix(text, "/") {
+			text = text[1:]
+		} else if !strings.Contains(text, "/") {
+			text = "**/" + text
+		}
+		if text == "" || !doublestar.ValidatePattern(text) {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", file, line, scanner.Text())
+		}
+		rule.pattern = text
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// ignored reports whether the directory at rel (a slash path relative to the root)
+// is ignored; the last matching rule wins, as in .gitignore
+func ignored(rules []ignoreRule, rel string) bool {
+	result := false
+	for _, rule := range rules {
+		name := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			name = rel[len(rule.base)+1:]
+		}
+		if doublestar.MatchUnvalidated(rule.pattern, name) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// matchPattern matches a slash path against an include or exclude pattern.
+// Patterns without a slash match the directory name at any depth, others the whole path.
+func matchPattern(pattern, rel string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	return doublestar.Match(pattern, rel)
+}
@@ -0,0 +1,81 @@
+package directories
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadList reads a directory list from file, or from standard input when file is "-"
+func ReadList(file string) ([]string, error) {
+	if file == "-" {
+		return ParseList(os.Stdin)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory list: %w", err)
+	}
+	defer f.Close()
+	return ParseList(f)
+}
+
+// ParseList reads one directory per line, skipping blank lines and # comments.
+// Paths are cleaned and duplicates are dropped, keeping the original order.
+func ParseList(r io.Reader) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dir := filepath.Clean(line)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read directory list: %w", err)
+	}
+	return dirs, nil
+}
+
+// SelectFromList applies the include, exclude and marker options of Discover to an explicit
+// list of directories. Relative entries are resolved against root. Entries that do not
+// exist are kept so that they are reported when processed.
+func SelectFromList(root string, dirs []string, opts Options) ([]string, error) {
+	for _, markers := range append([]Markers{opts.Markers}, opts.AnyOf...) {
+		if err := markers.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	dirs, err := FilterDirectories(dirs, opts.Include, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &walker{opts: opts}
+	var selected []string
+	for _, dir := range dirs {
+		path := dir
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, dir)
+		}
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			matched, err := w.hasMarkers(path)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		selected = append(selected, dir)
+	}
+	return selected, nil
+}
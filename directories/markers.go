@@ -0,0 +1,114 @@
+package directories
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// maxMatchSize limits how much of a file is read for content matching
+const maxMatchSize = 1 << 20
+
+// ContentMatch requires a file matching File whose content matches Pattern
+type ContentMatch struct {
+	File    string // Glob pattern relative to the directory
+	Pattern *regexp.Regexp
+}
+
+func (m ContentMatch) String() string {
+	return m.File + ":" + m.Pattern.String()
+}
+
+// ParseContentMatch parses a FILE:REGEX condition such as package.json:"name": "@acme/
+func ParseContentMatch(input string) (ContentMatch, error) {
+	file, pattern, ok := strings.Cut(input, ":")
+	if !ok || strings.TrimSpace(file) == "" {
+		return ContentMatch{}, fmt.Errorf("invalid match %q (use FILE:REGEX)", input)
+	}
+	return NewContentMatch(strings.TrimSpace(file), pattern)
+}
+
+// NewContentMatch validates the file pattern and compiles the content pattern of a condition
+func NewContentMatch(file, pattern string) (ContentMatch, error) {
+	if !doublestar.ValidatePattern(file) {
+		return ContentMatch{}, fmt.Errorf("invalid file pattern %q", file)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ContentMatch{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return ContentMatch{File: file, Pattern: re}, nil
+}
+
+// Markers select directories by what they contain. Every condition must hold.
+type Markers struct {
+	Require []string       // Glob patterns that must each match at least one file or directory
+	Match   []ContentMatch // Conditions on file contents
+}
+
+// Empty reports whether the markers have no conditions and therefore match any directory
+func (m Markers) Empty() bool {
+	return len(m.Require) == 0 && len(m.Match) == 0
+}
+
+// Validate reports invalid require patterns
+func (m Markers) Validate() error {
+	for _, pattern := range m.Require {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid file pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether dir satisfies every condition
+func (m Markers) Matches(dir string) (bool, error) {
+	fsys := os.DirFS(dir)
+	for _, pattern := range m.Require {
+		found, err := doublestar.Glob(fsys, pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+		if len(found) == 0 {
+			return false, nil
+		}
+	}
+
+	for _, match := range m.Match {
+		files, err := doublestar.Glob(fsys, match.File, doublestar.WithFilesOnly())
+		if err != nil {
+			return false, fmt.Errorf("invalid file pattern %q: %w", match.File, err)
+		}
+		matched := false
+		for _, file := range files {
+			if matched = contentMatches(filepath.Join(dir, filepath.FromSlash(file)), match.Pattern); matched {
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// contentMatches reports whether the beginning of file matches pattern;
+// unreadable files never match
+func contentMatches(file string, pattern *regexp.Regexp) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxMatchSize))
+	if err != nil {
+		return false
+	}
+	return pattern.Match(content)
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDirectoryCancelled is the cause of the context of a directory cancelled through a Controller
+var ErrDirectoryCancelled = errors.New("directory cancelled")
+
+// Controller cancels or skips individual directories while ExecuteCommands runs. A nil
+// Controller ignores every request.
+type Controller struct {
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc // Cancels each running directory
+	skipped map[string]bool                    // Directories to skip when their turn comes
+}
+
+// NewController creates a Controller for a single run of ExecuteCommands
+func NewController() *Controller {
+	return &Controller{
+		running: make(map[string]context.CancelCauseFunc),
+		skipped: make(map[string]bool),
+	}
+}
+
+// Cancel stops the commands of dir when it is running, or skips it when it has not started.
+// It reports whether dir was running.
+func (c *Controller) Cancel(dir string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[dir]; ok {
+		cancel(ErrDirectoryCancelled)
+		return true
+	}
+	c.skipped[dir] = true
+	return false
+}
+
+// start returns the context of dir derived from ctx, and false when dir is to be skipped
+func (c *Controller) start(ctx context.Context, dir string) (context.Context, bool) {
+	if c == nil {
+		return ctx, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skipped[dir] {
+		return ctx, false
+	}
+	dirCtx, cancel := context.WithCancelCause(ctx)
+	c.running[dir] = cancel
+	return dirCtx, true
+}
+
+// finish releases the context of dir once it is processed
+func (c *Controller) finish(dir string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[dir]; ok {
+		cancel(nil)
+		delete(c.running, dir)
+	}
+}
+
+// skipRequested reports whether dir is to be skipped
+func (c *Controller) skipRequested(dir string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skipped[dir]
+}
+
+// directoryCancelled reports whether ctx was cancelled through Controller.Cancel, as opposed
+// to the whole run
+func directoryCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrDirectoryCancelled)
+}
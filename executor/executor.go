@@ -2,11 +2,14 @@ package executor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gustavodamazio/mdir-run/config"
@@ -14,64 +17,254 @@ import (
 	"github.com/gustavodamazio/mdir-run/progress"
 )
 
+// timeoutError reports a command attempt or directory that exceeded its time limit
+type timeoutError struct {
+	scope string // "step" or "directory"
+	limit time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %s exceeded", e.scope, e.limit)
+}
+
 // executeWithRetryFunc recreates the command for each retry attempt to avoid "exec: already started" error
-func executeWithRetryFunc(cmdFunc func() *exec.Cmd, stdoutBuf, stderrBuf *bytes.Buffer, retries int) (int, error) {
+// The policy decides which failures are retried and how long to wait in between; retries stop
+// as soon as ctx is done. Each attempt is limited to timeout when set, and exit codes allowed
+// by the command count as success. Output is also copied live to stdoutLines and stderrLines when set.
+// It returns the number of attempts and the exit code of the last one, -1 when it did not exit.
+func executeWithRetryFunc(ctx context.Context, cmdFunc func(context.Context) *exec.Cmd, stdoutBuf, stderrBuf *bytes.Buffer, stdoutLines, stderrLines *progress.LineWriter, policy config.RetryPolicy, timeout time.Duration, command config.Command) (int, int, error) {
 	var err error
-	for attempt := 0; attempt <= retries; attempt++ {
+	code := -1
+	for attempt := 1; attempt <= policy.Attempts(); attempt++ {
 		// Reset buffers before each attempt
 		stdoutBuf.Reset()
 		stderrBuf.Reset()
 
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
 		// Create a new command instance for each attempt
-		cmd := cmdFunc()
-		cmd.Stdout = stdoutBuf
-		cmd.Stderr = stderrBuf
-		
+		cmd := cmdFunc(attemptCtx)
+		cmd.Stdout = liveOutput(stdoutBuf, stdoutLines)
+		cmd.Stderr = liveOutput(stderrBuf, stderrLines)
+
 		err = cmd.Run()
+		code = exitCode(err)
+		stdoutLines.Flush()
+		stderrLines.Flush()
+		timedOut := attemptCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		if err != nil && !timedOut && ctx.Err() == nil && command.AllowsExitCode(code) {
+			err = nil
+		}
 		if err == nil {
-			return attempt + 1, nil // Command succeeded, return attempt number (1-indexed)
+			return attempt, code, nil // Command succeeded, return attempt number (1-indexed)
+		}
+		if ctx.Err() != nil {
+			return attempt, code, ctx.Err()
+		}
+		if timedOut {
+			err = &timeoutError{scope: "step", limit: timeout}
 		}
 
-		// Don't sleep after the last attempt
-		if attempt < retries {
-			time.Sleep(time.Second * time.Duration(attempt+1)) // Simple linear backoff
+		// Stop when the failure does not qualify for a retry or no attempts are left
+		if !policy.ShouldRetry(code, stderrBuf.String(), timedOut) || attempt == policy.Attempts() {
+			return attempt, code, err
 		}
+
+		select {
+		case <-time.After(policy.DelayBefore(attempt)):
+		case <-ctx.Done():
+			return attempt, code, ctx.Err()
+		}
+	}
+	return policy.Attempts(), code, err // Return the last attempt number and last error
+}
+
+// liveOutput returns the writer capturing a command output in buf and, when set, in lines
+func liveOutput(buf *bytes.Buffer, lines *progress.LineWriter) io.Writer {
+	if lines == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, lines)
+}
+
+// exitCode returns the exit code of a finished command, or -1 when it has none
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
 	}
-	return retries + 1, err // Return the last attempt number and last error
+	return -1
 }
 
+// buildCommand creates the process for a configured command, wrapping the command line
+// in the shell interpreter when shell mode is enabled
+// The process is stopped when ctx is cancelled
+func buildCommand(ctx context.Context, command config.Command, cfg *config.Config, dirPath string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if cfg.Shell {
+		interpreter := cfg.ShellInterpreter
+		if len(interpreter) == 0 {
+			interpreter = config.DefaultShellInterpreter()
+		}
+		args := append(append([]string{}, interpreter[1:]...), command.Line)
+		cmd = exec.CommandContext(ctx, interpreter[0], args...)
+	} else {
+		cmd = exec.CommandContext(ctx, command.Args[0], command.Args[1:]...)
+	}
+	cmd.Dir = dirPath
+
+	gracePeriod := cfg.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = config.DefaultGracePeriod
+	}
+	configureCancel(cmd, gracePeriod)
+	if len(cfg.Env) > 0 {
+		cmd.Env = append(os.Environ(), cfg.Env...)
+	}
+	return cmd
+}
+
+// ErrFailureLimit is returned by ExecuteCommands when a failure limit stopped the run
+var ErrFailureLimit = errors.New("failure limit reached")
+
 // ExecuteCommands executes commands in multiple directories concurrently
-// This is used by the GUI mode
-func ExecuteCommands(dirs []string, cfg *config.Config, progressManager *progress.ProgressManager) {
+// Once ctx is cancelled no new directory is started and running commands are stopped;
+// every directory still gets a final status and log entry.
+// When a failure limit of cfg is reached, directories not yet started are marked SKIPPED
+// and running ones finish, or are cancelled with cfg.AbortRunning.
+// control, when not nil, cancels or skips single directories on request.
+func ExecuteCommands(ctx context.Context, dirs []string, cfg *config.Config, progressManager *progress.ProgressManager, control *Controller) error {
 	// Limit concurrency
-	semaphore := make(chan struct{}, cfg.Concurrency)
-	
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// limitReached is closed once enough directories failed to stop the run;
+	// runCtx is cancelled at that point too when running directories are aborted
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	limitReached := make(chan struct{})
+	var mu sync.Mutex
+	failures, skipped, stopped := 0, 0, false
+	recordResult := func(dir string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !progress.IsFailure(progressManager.GetProgress(dir).Status) {
+			return
+		}
+		failures++
+		if !stopped && cfg.FailureLimitReached(failures, len(dirs)) {
+			stopped = true
+			close(limitReached)
+			if cfg.AbortRunning {
+				cancelRun()
+			}
+		}
+	}
+
 	// Process directories
 	for _, dir := range dirs {
-		semaphore <- struct{}{}
+		// Directories finished by an interrupted run that is being resumed
+		if progressManager.Finished(dir) {
+			continue
+		}
+		if control.skipRequested(dir) {
+			skipRepo(dir, "Skipped by the user", cfg, progressManager)
+			continue
+		}
+
+		select {
+		case <-limitReached:
+			skipRepo(dir, "Not started, failure limit reached", cfg, progressManager)
+			skipped++
+			continue
+		default:
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-limitReached:
+			skipRepo(dir, "Not started, failure limit reached", cfg, progressManager)
+			skipped++
+			continue
+		case <-ctx.Done():
+			// ProcessRepo records the directory as cancelled without running anything
+			ProcessRepo(ctx, dir, cfg, progressManager)
+			continue
+		}
+
+		// The directory may have been skipped while it waited for a slot
+		dirCtx, ok := control.start(runCtx, dir)
+		if !ok {
+			<-semaphore
+			skipRepo(dir, "Skipped by the user", cfg, progressManager)
+			continue
+		}
+
+		wg.Add(1)
 		go func(dir string) {
+			defer wg.Done()
 			defer func() { <-semaphore }()
-			ProcessRepo(dir, cfg, progressManager)
+			defer control.finish(dir)
+			ProcessRepo(dirCtx, dir, cfg, progressManager)
+			recordResult(dir)
 		}(dir)
 	}
-	
+
 	// Wait for all goroutines to finish
-	for i := 0; i < cfg.Concurrency; i++ {
-		semaphore <- struct{}{}
+	wg.Wait()
+
+	select {
+	case <-limitReached:
+		return fmt.Errorf("%w: %d of %d directories failed, %d skipped", ErrFailureLimit, failures, len(dirs), skipped)
+	default:
+		return nil
 	}
 }
 
-func ProcessRepo(dir string, cfg *config.Config, progressManager *progress.ProgressManager) {
-	progress := progressManager.GetProgress(dir)
+// skipRepo records a directory that was not started, because a failure limit was reached or
+// it was skipped on request, with the reason why
+func skipRepo(dir, reason string, cfg *config.Config, progressManager *progress.ProgressManager) {
+	dirProgress := progressManager.GetProgress(dir)
+	dirProgress.Status = progress.StatusSkipped
+	dirProgress.Command = reason
+	logger.WriteLog(cfg.LogFile, dirProgress.Status, 0, dir)
+	progressManager.UpdateProgress(dir, dirProgress)
+}
+
+func ProcessRepo(ctx context.Context, dir string, cfg *config.Config, progressManager *progress.ProgressManager) {
+	dirProgress := progressManager.GetProgress(dir)
 	startTime := time.Now()
-	status := "SUCCESS"
+	status := progress.StatusSuccess
 
-	dirPath := filepath.Join(cfg.InitialDir, dir)
+	// Directories reached after cancellation are not started
+	if ctx.Err() != nil {
+		dirProgress.Status = progress.StatusCancelled
+		dirProgress.Command = "Not started"
+		logger.WriteLog(cfg.LogFile, dirProgress.Status, 0, dir)
+		progressManager.UpdateProgress(dir, dirProgress)
+		return
+	}
+
+	dirProgress.Started = startTime
+	progressManager.UpdateProgress(dir, dirProgress)
+
+	dirPath := cfg.DirPath(dir)
 	stat, err := os.Stat(dirPath)
 	if err != nil || !stat.IsDir() {
-		progress.Status = "FAIL"
+		dirProgress.Status = progress.StatusFail
 		errorMsg := fmt.Sprintf("Failed to access directory: %s", dirPath)
-		progress.Command = errorMsg
+		dirProgress.Command = errorMsg
 
 		// Write detailed error log for directory access failure
 		var errorDetails string
@@ -82,88 +275,230 @@ func ProcessRepo(dir string, cfg *config.Config, progressManager *progress.Progr
 		}
 		logger.WriteErrorLog(cfg.LogFile, dir, errorDetails)
 
-		logger.WriteLog(cfg.LogFile, progress.Status, time.Since(startTime).Seconds(), dir)
+		logger.WriteLog(cfg.LogFile, dirProgress.Status, time.Since(startTime).Seconds(), dir)
 
-		progressManager.UpdateProgress(dir, progress)
+		progressManager.UpdateProgress(dir, dirProgress)
 		return
 	}
 
-	// Check if 'SubDirsEntryPoints' directories exist
-	for _, subDir := range cfg.SubDirsEntryPoints {
-		subDirPath := filepath.Join(dirPath, subDir)
-		if stat, err := os.Stat(subDirPath); err == nil && stat.IsDir() {
-			dirPath = subDirPath
-			break
-		}
+	// Pick the commands of the project type detected in the directory
+	commands, project, err := cfg.CommandsFor(dirPath)
+	if err != nil {
+		dirProgress.Status = progress.StatusFail
+		dirProgress.Command = fmt.Sprintf("Failed to detect project type: %v", err)
+		logger.WriteErrorLog(cfg.LogFile, dir, fmt.Sprintf("Error: %v", err))
+		logger.WriteLog(cfg.LogFile, dirProgress.Status, time.Since(startTime).Seconds(), dir)
+		progressManager.UpdateProgress(dir, dirProgress)
+		return
+	}
+	if len(commands) == 0 {
+		dirProgress.Status = progress.StatusSkipped
+		dirProgress.Command = "No matching project type"
+		logger.WriteLog(cfg.LogFile, dirProgress.Status, 0, dir)
+		progressManager.UpdateProgress(dir, dirProgress)
+		return
+	}
+
+	// Commands run in the first 'SubDirsEntryPoints' directory that exists
+	dirPath = cfg.WorkDir(dir)
+
+	// Limit the time spent on this directory
+	dirCtx := ctx
+	if cfg.DirTimeout > 0 {
+		var cancel context.CancelFunc
+		dirCtx, cancel = context.WithTimeout(ctx, cfg.DirTimeout)
+		defer cancel()
+	}
+
+	dirProgress.Total = len(commands)
+	for _, command := range commands {
+		dirProgress.Commands = append(dirProgress.Commands, command.String())
+	}
+	var stepDetail strings.Builder
+	if project != "" {
+		stepDetail.WriteString(fmt.Sprintf("Project type: %s\n", project))
 	}
+	stepDetail.WriteString(fmt.Sprintf("Working directory: %s\n\n", dirPath))
 
-	progress.Total = len(cfg.Commands)
-	var successDetail strings.Builder
-	successDetail.WriteString(fmt.Sprintf("Working directory: %s\n\n", dirPath))
+	// Once a step fails the directory, the remaining steps are skipped unless they are always_run
+	failed := false
+	var failureDetail, failureCommand, failureOutput string
+
+	// Steps before the start step completed in an earlier run
+	start := cfg.StartSteps[dir]
+
+	for i, command := range commands {
+		cmdString := command.String()
+		stepCtx := dirCtx
+
+		if i+1 < start {
+			stepDetail.WriteString(fmt.Sprintf("Command %d/%d: %s\nCompleted in a previous run\n\n---\n\n", i+1, dirProgress.Total, cmdString))
+			continue
+		}
 
-	for i, cmdArgs := range cfg.Commands {
-		progress.Step = i + 1
-		cmdString := strings.Join(cmdArgs, " ")
-		progress.Command = cmdString
-		progressManager.UpdateProgress(dir, progress)
+		if !failed && dirCtx.Err() != nil {
+			failed = true
+			reason := "Run cancelled"
+			if directoryCancelled(ctx) {
+				reason = "Directory cancelled"
+			}
+			status = progress.StatusCancelled
+			failureCommand = fmt.Sprintf("Cancelled before %s", cmdString)
+			if ctx.Err() == nil {
+				reason = fmt.Sprintf("Directory timeout of %s exceeded", cfg.DirTimeout)
+				status = progress.StatusTimeout
+				failureCommand = fmt.Sprintf("Timed out before %s", cmdString)
+			}
+			failureDetail = fmt.Sprintf("%s before command %d/%d: %s", reason, i+1, dirProgress.Total, cmdString)
+			dirProgress.FailedStep = i + 1
+		}
+		if failed {
+			if !command.AlwaysRun || ctx.Err() != nil {
+				dirProgress.SkippedSteps = append(dirProgress.SkippedSteps, i+1)
+				stepDetail.WriteString(fmt.Sprintf("Command %d/%d: %s\nSkipped after an earlier failure\n\n---\n\n", i+1, dirProgress.Total, cmdString))
+				continue
+			}
+			// Cleanup steps still run after a failure or a directory timeout
+			stepCtx = ctx
+		}
 
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-		cmd.Dir = dirPath
+		dirProgress.Step = i + 1
+		dirProgress.Command = cmdString
+		dirProgress.Attempt = 1
+		progressManager.UpdateProgress(dir, dirProgress)
 
 		// Capture the output
 		var stdoutBuf, stderrBuf bytes.Buffer
-		// Create a function that returns a new command instance for each retry
-		cmdFunc := func() *exec.Cmd {
-			newCmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-			newCmd.Dir = dirPath
-			return newCmd
+		// Create a function that returns a new command instance for each retry, reporting the
+		// retry so that its output can be told apart from the previous attempt
+		attempts := 0
+		cmdFunc := func(ctx context.Context) *exec.Cmd {
+			attempts++
+			if attempts > 1 {
+				dirProgress.Attempt = attempts
+				progressManager.UpdateProgress(dir, dirProgress)
+			}
+			return buildCommand(ctx, command, cfg, dirPath)
 		}
 
-		attemptNumber, err := executeWithRetryFunc(cmdFunc, &stdoutBuf, &stderrBuf, cfg.Retries)
+		// Per-step settings take precedence over the run-wide ones
+		timeout := cfg.StepTimeout
+		if command.Timeout > 0 {
+			timeout = command.Timeout
+		}
+		policy := cfg.RetryPolicyFor(command)
+
+		stepStart := time.Now()
+		stdoutLines, stderrLines := progressManager.StepOutput(dir, i+1)
+		attemptNumber, code, err := executeWithRetryFunc(stepCtx, cmdFunc, &stdoutBuf, &stderrBuf, stdoutLines, stderrLines, policy, timeout, command)
+		stepResult := progress.StepResult{
+			Step:        i + 1,
+			Command:     cmdString,
+			ExitCode:    code,
+			Attempts:    attemptNumber,
+			MaxAttempts: policy.Attempts(),
+			Started:     stepStart,
+			Duration:    time.Since(stepStart),
+			Stdout:      stdoutBuf.String(),
+			Stderr:      stderrBuf.String(),
+		}
 		if err != nil {
-			progress.Status = fmt.Sprintf("FAIL(%d/%d)", attemptNumber, cfg.Retries+1)
-			errorOutput := stderrBuf.String()
-			progress.Output = errorOutput
-			progress.Command = fmt.Sprintf("Failed to execute %s", progress.Command)
+			var stepTimeout *timeoutError
+			var stepStatus, stepCommand string
+			stopsDirectory := !command.ContinueOnError
+			switch {
+			case ctx.Err() != nil:
+				err = errors.New("run cancelled")
+				if directoryCancelled(ctx) {
+					err = ErrDirectoryCancelled
+				}
+				stepStatus = progress.StatusCancelled
+				stepCommand = fmt.Sprintf("Cancelled during %s", cmdString)
+				stopsDirectory = true
+			case stepCtx.Err() != nil:
+				err = &timeoutError{scope: "directory", limit: cfg.DirTimeout}
+				stepStatus = progress.StatusTimeout
+				stepCommand = fmt.Sprintf("Timed out during %s", cmdString)
+				stopsDirectory = true
+			case errors.As(err, &stepTimeout):
+				stepStatus = fmt.Sprintf("%s(%d/%d)", progress.StatusTimeout, attemptNumber, policy.Attempts())
+				stepCommand = fmt.Sprintf("Timed out during %s", cmdString)
+			default:
+				stepStatus = fmt.Sprintf("%s(%d/%d)", progress.StatusFail, attemptNumber, policy.Attempts())
+				stepCommand = fmt.Sprintf("Failed to execute %s", cmdString)
+			}
+			dirProgress.FailedSteps = append(dirProgress.FailedSteps, i+1)
+			stepResult.Status = stepStatus
+			stepResult.Error = err.Error()
+			stepResult.StopsDirectory = stopsDirectory
+			progressManager.StepFinished(dir, stepResult)
 
-			// Write detailed error log to separate file
 			// Include both stdout and stderr in the error log
 			errorDetails := fmt.Sprintf("Command: %s\nError: %v\nAttempt: %d/%d\nStderr Output:\n%s\nStdout Output:\n%s",
-				progress.Command, err, attemptNumber, cfg.Retries+1, errorOutput, stdoutBuf.String())
-			logger.WriteErrorLog(cfg.LogFile, dir, errorDetails)
+				stepCommand, err, attemptNumber, policy.Attempts(), stderrBuf.String(), stdoutBuf.String())
+			stepDetail.WriteString(fmt.Sprintf("Command %d/%d: %s\n", i+1, dirProgress.Total, cmdString))
+			if !stopsDirectory {
+				stepDetail.WriteString("Failed, continuing (continue_on_error)\n")
+			}
+			stepDetail.WriteString(errorDetails + "\n\n---\n\n")
 
-			progressManager.UpdateProgress(dir, progress)
-			break
-		} 
+			// Only the first failure decides the directory status
+			if stopsDirectory && !failed {
+				failed = true
+				dirProgress.FailedStep = i + 1
+				status = stepStatus
+				failureCommand = stepCommand
+				failureOutput = stderrBuf.String()
+				failureDetail = errorDetails
+			}
+			continue
+		}
 		// Always show the attempt count for SUCCESS, regardless of retry count
-		status = fmt.Sprintf("SUCCESS(%d/%d)", attemptNumber, cfg.Retries+1)
+		stepResult.Status = fmt.Sprintf("%s(%d/%d)", progress.StatusSuccess, attemptNumber, policy.Attempts())
+		progressManager.StepFinished(dir, stepResult)
+		if !failed {
+			status = stepResult.Status
+		}
 
-		// Add command execution details for success log
-		successDetail.WriteString(fmt.Sprintf("Command %d/%d: %s\n", i+1, progress.Total, cmdString))
-		successDetail.WriteString(fmt.Sprintf("Attempts needed: %d/%d\n", attemptNumber, cfg.Retries+1))
+		// Add command execution details for the log
+		stepDetail.WriteString(fmt.Sprintf("Command %d/%d: %s\n", i+1, dirProgress.Total, cmdString))
+		stepDetail.WriteString(fmt.Sprintf("Attempts needed: %d/%d\n", attemptNumber, policy.Attempts()))
 
 		if stdoutBuf.Len() > 0 {
-			successDetail.WriteString(fmt.Sprintf("Stdout Output:\n%s\n", stdoutBuf.String()))
+			stepDetail.WriteString(fmt.Sprintf("Stdout Output:\n%s\n", stdoutBuf.String()))
 		} else {
-			successDetail.WriteString("Stdout: No output\n")
+			stepDetail.WriteString("Stdout: No output\n")
 		}
 
 		if stderrBuf.Len() > 0 {
-			successDetail.WriteString(fmt.Sprintf("Stderr Output:\n%s\n", stderrBuf.String()))
+			stepDetail.WriteString(fmt.Sprintf("Stderr Output:\n%s\n", stderrBuf.String()))
 		}
 
-		successDetail.WriteString("\n---\n\n")
+		stepDetail.WriteString("\n---\n\n")
 	}
 
 	executionTime := time.Since(startTime).Seconds()
-	if progress.Status != "FAIL" && !strings.HasPrefix(progress.Status, "FAIL(") {
-		progress.Status = status
+	dirProgress.Duration = time.Since(startTime)
+	dirProgress.Status = status
+	summary := dirProgress.StepSummary()
+	if failed {
+		dirProgress.Command = failureCommand
+		dirProgress.Output = failureOutput
 
+		// Write error log with the failure first, followed by every step
+		if summary != "" {
+			failureDetail += fmt.Sprintf("\n\nSteps: %s", summary)
+		}
+		logger.WriteErrorLog(cfg.LogFile, dir, fmt.Sprintf("%s\n\n%s", failureDetail, stepDetail.String()))
+	} else {
 		// Write success log with execution details
-		successDetail.WriteString(fmt.Sprintf("\nExecution completed in %.2f seconds", executionTime))
-		logger.WriteSuccessLog(cfg.LogFile, dir, successDetail.String())
+		if summary != "" {
+			stepDetail.WriteString(fmt.Sprintf("Steps: %s\n", summary))
+		}
+		stepDetail.WriteString(fmt.Sprintf("\nExecution completed in %.2f seconds", executionTime))
+		logger.WriteSuccessLog(cfg.LogFile, dir, stepDetail.String())
 	}
 
-	logger.WriteLog(cfg.LogFile, progress.Status, executionTime, dir)
-	progressManager.UpdateProgress(dir, progress)
+	logger.WriteLog(cfg.LogFile, dirProgress.Status, executionTime, dir)
+	progressManager.UpdateProgress(dir, dirProgress)
 }
@@ -0,0 +1,363 @@
+//go:build unix
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/config"
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// testConfig creates the directories dirs under a temporary root and returns a configuration
+// running commands in them through the shell, logging to another temporary directory
+func testConfig(t *testing.T, dirs []string, commands ...config.Command) *config.Config {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &config.Config{
+		InitialDir:  root,
+		LogFile:     filepath.Join(t.TempDir(), "script.log"),
+		Commands:    commands,
+		Concurrency: 1,
+		Shell:       true,
+		GracePeriod: 100 * time.Millisecond,
+		Retry:       config.RetryPolicy{Backoff: config.BackoffConstant, Delay: time.Millisecond},
+	}
+}
+
+// shell returns the commands run through the shell of testConfig
+func shell(lines ...string) []config.Command {
+	var commands []config.Command
+	for _, line := range lines {
+		commands = append(commands, config.Command{Line: line})
+	}
+	return commands
+}
+
+// run processes dirs with cfg and returns the final progress of every directory
+func run(t *testing.T, ctx context.Context, cfg *config.Config, dirs ...string) (map[string]*progress.Progress, error) {
+	t.Helper()
+	pm := progress.NewProgressManager(dirs)
+	err := ExecuteCommands(ctx, dirs, cfg, pm, nil)
+	results := make(map[string]*progress.Progress)
+	for _, dir := range dirs {
+		results[dir] = pm.GetProgress(dir)
+	}
+	return results, err
+}
+
+// countLines returns the number of lines of a file written by the commands, 0 when missing
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, b := range data {
+		if b == '\n' {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		commands    []config.Command
+		stepTimeout time.Duration
+		dirTimeout  time.Duration
+		status      string
+		skipped     []int
+	}{
+		{
+			name:        "step timeout",
+			commands:    shell("sleep 10"),
+			stepTimeout: 100 * time.Millisecond,
+			status:      "TIMEOUT(1/1)",
+		},
+		{
+			name:     "per-step timeout",
+			commands: []config.Command{{Line: "true"}, {Line: "sleep 10", Timeout: 100 * time.Millisecond}},
+			status:   "TIMEOUT(1/1)",
+		},
+		{
+			name:        "per-step timeout overrides the run-wide one",
+			commands:    []config.Command{{Line: "sleep 0.3", Timeout: 5 * time.Second}},
+			stepTimeout: 100 * time.Millisecond,
+			status:      "SUCCESS(1/1)",
+		},
+		{
+			name:       "directory timeout",
+			commands:   shell("sleep 10", "echo never"),
+			dirTimeout: 100 * time.Millisecond,
+			status:     progress.StatusTimeout,
+			skipped:    []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, []string{"a"}, tt.commands...)
+			cfg.StepTimeout = tt.stepTimeout
+			cfg.DirTimeout = tt.dirTimeout
+
+			start := time.Now()
+			results, err := run(t, context.Background(), cfg, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("took %s, the timeout did not stop the command", elapsed)
+			}
+			if got := results["a"]; got.Status != tt.status || !slices.Equal(got.SkippedSteps, tt.skipped) {
+				t.Errorf("got status %s with skipped steps %v, want %s with %v", got.Status, got.SkippedSteps, tt.status, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestRetryConditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		retry    config.RetryPolicy
+		timeout  time.Duration
+		status   string
+		attempts int
+	}{
+		{
+			name:     "any failure",
+			command:  "exit 1",
+			retry:    config.RetryPolicy{Retries: 2},
+			status:   "FAIL(3/3)",
+			attempts: 3,
+		},
+		{
+			name:     "succeeds on a retry",
+			command:  "test -f marker || { touch marker; exit 1; }",
+			retry:    config.RetryPolicy{Retries: 2},
+			status:   "SUCCESS(2/3)",
+			attempts: 2,
+		},
+		{
+			name:     "listed exit code",
+			command:  "exit 3",
+			retry:    config.RetryPolicy{Retries: 1, OnExitCodes: []int{3}},
+			status:   "FAIL(2/2)",
+			attempts: 2,
+		},
+		{
+			name:     "unlisted exit code",
+			command:  "exit 4",
+			retry:    config.RetryPolicy{Retries: 1, OnExitCodes: []int{3}},
+			status:   "FAIL(1/2)",
+			attempts: 1,
+		},
+		{
+			name:     "matching stderr",
+			command:  "echo 'connection reset' >&2; exit 1",
+			retry:    config.RetryPolicy{Retries: 1, OnStderr: []*regexp.Regexp{regexp.MustCompile("reset")}},
+			status:   "FAIL(2/2)",
+			attempts: 2,
+		},
+		{
+			name:     "other stderr",
+			command:  "echo 'not found' >&2; exit 1",
+			retry:    config.RetryPolicy{Retries: 1, OnStderr: []*regexp.Regexp{regexp.MustCompile("reset")}},
+			status:   "FAIL(1/2)",
+			attempts: 1,
+		},
+		{
+			name:     "timeout not retried",
+			command:  "sleep 10",
+			retry:    config.RetryPolicy{Retries: 1},
+			timeout:  100 * time.Millisecond,
+			status:   "TIMEOUT(1/2)",
+			attempts: 1,
+		},
+		{
+			name:     "timeout retried",
+			command:  "sleep 10",
+			retry:    config.RetryPolicy{Retries: 1, OnTimeout: true},
+			timeout:  100 * time.Millisecond,
+			status:   "TIMEOUT(2/2)",
+			attempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, []string{"a"}, shell("echo >> attempts; "+tt.command)...)
+			cfg.Retry = tt.retry
+			cfg.Retry.Backoff = config.BackoffConstant
+			cfg.Retry.Delay = time.Millisecond
+			cfg.StepTimeout = tt.timeout
+
+			results, err := run(t, context.Background(), cfg, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results["a"].Status; got != tt.status {
+				t.Errorf("status %s, want %s", got, tt.status)
+			}
+			if got := countLines(t, filepath.Join(cfg.InitialDir, "a", "attempts")); got != tt.attempts {
+				t.Errorf("ran %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestStepFailureSemantics(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []config.Command
+		status   string
+		failed   []int
+		skipped  []int
+		ran      []string // Files touched by the steps that ran
+	}{
+		{
+			name:     "failure skips the remaining steps",
+			commands: shell("exit 1", "touch second"),
+			status:   "FAIL(1/1)",
+			failed:   []int{1},
+			skipped:  []int{2},
+		},
+		{
+			name:     "always_run runs after a failure",
+			commands: []config.Command{{Line: "exit 1"}, {Line: "touch second"}, {Line: "touch cleanup", AlwaysRun: true}},
+			status:   "FAIL(1/1)",
+			failed:   []int{1},
+			skipped:  []int{2},
+			ran:      []string{"cleanup"},
+		},
+		{
+			name:     "always_run after a directory timeout",
+			commands: []config.Command{{Line: "sleep 10"}, {Line: "touch cleanup", AlwaysRun: true}},
+			status:   progress.StatusTimeout,
+			failed:   []int{1},
+			ran:      []string{"cleanup"},
+		},
+		{
+			name:     "continue_on_error",
+			commands: []config.Command{{Line: "exit 1", ContinueOnError: true}, {Line: "touch second"}},
+			status:   "SUCCESS(1/1)",
+			failed:   []int{1},
+			ran:      []string{"second"},
+		},
+		{
+			name:     "allowed exit code",
+			commands: []config.Command{{Line: "exit 2", AllowedExitCodes: []int{2}}, {Line: "touch second"}},
+			status:   "SUCCESS(1/1)",
+			ran:      []string{"second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, []string{"a"}, tt.commands...)
+			cfg.DirTimeout = time.Second
+
+			results, err := run(t, context.Background(), cfg, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results["a"]
+			if got.Status != tt.status || !slices.Equal(got.FailedSteps, tt.failed) || !slices.Equal(got.SkippedSteps, tt.skipped) {
+				t.Errorf("got status %s, failed steps %v and skipped steps %v, want %s, %v and %v",
+					got.Status, got.FailedSteps, got.SkippedSteps, tt.status, tt.failed, tt.skipped)
+			}
+			for _, name := range []string{"second", "cleanup"} {
+				_, err := os.Stat(filepath.Join(cfg.InitialDir, "a", name))
+				if ran := err == nil; ran != slices.Contains(tt.ran, name) {
+					t.Errorf("step touching %s ran: %t", name, ran)
+				}
+			}
+		})
+	}
+}
+
+func TestFailureLimits(t *testing.T) {
+	dirs := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		name        string
+		failFast    bool
+		maxFailures int
+		statuses    []string
+		limit       bool
+	}{
+		{
+			name:     "no limit",
+			statuses: []string{"FAIL(1/1)", "FAIL(1/1)", "FAIL(1/1)", "FAIL(1/1)"},
+		},
+		{
+			name:     "fail fast",
+			failFast: true,
+			statuses: []string{"FAIL(1/1)", progress.StatusSkipped, progress.StatusSkipped, progress.StatusSkipped},
+			limit:    true,
+		},
+		{
+			name:        "max failures",
+			maxFailures: 2,
+			statuses:    []string{"FAIL(1/1)", "FAIL(1/1)", progress.StatusSkipped, progress.StatusSkipped},
+			limit:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, dirs, shell("exit 1")...)
+			cfg.FailFast = tt.failFast
+			cfg.MaxFailures = tt.maxFailures
+
+			results, err := run(t, context.Background(), cfg, dirs...)
+			if limit := errors.Is(err, ErrFailureLimit); limit != tt.limit {
+				t.Errorf("got error %v, want the failure limit reached: %t", err, tt.limit)
+			}
+			for i, dir := range dirs {
+				if got := results[dir].Status; got != tt.statuses[i] {
+					t.Errorf("%s: status %s, want %s", dir, got, tt.statuses[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	cfg := testConfig(t, []string{"a", "b"}, shell("sleep 10; touch finished", "touch second")...)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	results, err := run(t, ctx, cfg, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s, cancelling did not stop the command", elapsed)
+	}
+
+	for _, dir := range []string{"a", "b"} {
+		if got := results[dir].Status; got != progress.StatusCancelled {
+			t.Errorf("%s: status %s, want %s", dir, got, progress.StatusCancelled)
+		}
+		for _, name := range []string{"finished", "second"} {
+			if _, err := os.Stat(filepath.Join(cfg.InitialDir, dir, name)); err == nil {
+				t.Errorf("%s: %s was created after the run was cancelled", dir, name)
+			}
+		}
+	}
+	if got := results["b"].Command; got != "Not started" {
+		t.Errorf("b: %q, want it not started", got)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package executor
+
+import (
+	"os/exec"
+	"time"
+)
+
+// configureCancel keeps the default cancellation, which kills the direct child only since
+// there are no process groups here; the grace period bounds the wait for its output pipes
+func configureCancel(cmd *exec.Cmd, gracePeriod time.Duration) {
+	cmd.WaitDelay = gracePeriod
+}
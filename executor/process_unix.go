@@ -0,0 +1,24 @@
+//go:build unix
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// configureCancel runs the command in its own process group so cancellation reaches
+// every child it spawned: the group gets SIGTERM first and SIGKILL after the grace period
+func configureCancel(cmd *exec.Cmd, gracePeriod time.Duration) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		time.AfterFunc(gracePeriod, func() {
+			syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	// Stop waiting for output pipes held open by orphaned children
+	cmd.WaitDelay = gracePeriod + time.Second
+}
@@ -0,0 +1,368 @@
+package gui
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// detailRefreshInterval limits how often the detail pane redraws while output arrives
+const detailRefreshInterval = 200 * time.Millisecond
+
+// detailMaxLines is how many of the last lines of a stream the detail pane shows; Copy
+// always copies everything
+const detailMaxLines = 2000
+
+// stepOutput is the output of a step, live while it runs
+type stepOutput struct {
+	step    int
+	command string
+	attempt int                  // Attempt running, whose output stdout and stderr hold
+	stdout  []string             // Lines received while the step runs
+	stderr  []string             // Lines received while the step runs
+	result  *progress.StepResult // Set once the step finished, with its complete output
+}
+
+// text returns the complete stdout and stderr of the step
+func (s *stepOutput) text() (stdout, stderr string) {
+	if s.result != nil {
+		return s.result.Stdout, s.result.Stderr
+	}
+	return strings.Join(s.stdout, "\n"), strings.Join(s.stderr, "\n")
+}
+
+// dirOutput is what the detail pane shows for a directory
+type dirOutput struct {
+	status string
+	steps  []*stepOutput
+}
+
+// outputStore keeps the steps and output of every directory of a run for the detail pane
+type outputStore struct {
+	mu      sync.Mutex
+	dirs    map[string]*dirOutput
+	changed func(dir string) // Called whenever the output of dir changes
+}
+
+func newOutputStore(changed func(dir string)) *outputStore {
+	return &outputStore{dirs: make(map[string]*dirOutput), changed: changed}
+}
+
+// dir returns the output of dir, creating it when needed; the store must be locked
+func (o *outputStore) dir(dir string) *dirOutput {
+	output, ok := o.dirs[dir]
+	if !ok {
+		output = &dirOutput{}
+		o.dirs[dir] = output
+	}
+	return output
+}
+
+// step returns the output of a step of dir, creating it when needed; the store must be locked
+func (o *outputStore) step(dir string, step int, command string) *stepOutput {
+	output := o.dir(dir)
+	for i := len(output.steps) - 1; i >= 0; i-- {
+		if output.steps[i].step == step {
+			return output.steps[i]
+		}
+	}
+	stepOut := &stepOutput{step: step, command: command}
+	output.steps = append(output.steps, stepOut)
+	return stepOut
+}
+
+// update records the status of a directory, as shown in the progress list, and the step it started
+func (o *outputStore) update(p *progress.Progress, status string) {
+	o.mu.Lock()
+	o.dir(p.Dir).status = status
+	if p.Status == progress.StatusProcessing && p.Step > 0 {
+		stepOut := o.step(p.Dir, p.Step, p.Command)
+		if p.Attempt > stepOut.attempt {
+			// A retry only shows its own output, like the result of the step
+			stepOut.attempt = p.Attempt
+			stepOut.stdout, stepOut.stderr = nil, nil
+		}
+	}
+	o.mu.Unlock()
+	o.changed(p.Dir)
+}
+
+// writers returns the writers collecting the live stdout and stderr of a step
+func (o *outputStore) writers(dir string, step int) (stdout, stderr *progress.LineWriter) {
+	collect := func(stderr bool) *progress.LineWriter {
+		return progress.NewLineWriter(func(line string) {
+			o.mu.Lock()
+			stepOut := o.step(dir, step, "")
+			if stderr {
+				stepOut.stderr = append(stepOut.stderr, line)
+			} else {
+				stepOut.stdout = append(stepOut.stdout, line)
+			}
+			o.mu.Unlock()
+			o.changed(dir)
+		})
+	}
+	return collect(false), collect(true)
+}
+
+// finished records the result of a step, replacing its live output with the complete one
+func (o *outputStore) finished(dir string, result progress.StepResult) {
+	o.mu.Lock()
+	stepOut := o.step(dir, result.Step, result.Command)
+	stepOut.command = result.Command
+	stepOut.result = &result
+	stepOut.stdout, stepOut.stderr = nil, nil
+	o.mu.Unlock()
+	o.changed(dir)
+}
+
+// stepView is the part of the detail pane showing a step
+type stepView struct {
+	item   *widget.AccordionItem
+	info   *widget.Label
+	stdout *widget.Label
+	stderr *widget.Label
+}
+
+// detailPane shows the steps of a directory with their output, updated live while it runs
+type detailPane struct {
+	gui       *GUI
+	dir       string
+	title     *widget.Label
+	status    *widget.Label
+	accordion *widget.Accordion
+	views     []*stepView
+	content   fyne.CanvasObject
+	pending   atomic.Bool // A redraw is scheduled
+}
+
+// newDetailPane creates the pane showing dir
+func newDetailPane(g *GUI, dir string) *detailPane {
+	pane := &detailPane{
+		gui:       g,
+		dir:       dir,
+		title:     widget.NewLabelWithStyle(dir, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		status:    widget.NewLabel(""),
+		accordion: widget.NewAccordion(),
+	}
+	pane.accordion.MultiOpen = true
+	pane.title.Truncation = fyne.TextTruncateEllipsis
+	pane.status.Wrapping = fyne.TextWrapWord
+
+	openButton := widget.NewButtonWithIcon("Open working directory", theme.FolderOpenIcon(), pane.openDirectory)
+	copyButton := widget.NewButtonWithIcon("Copy all", theme.ContentCopyIcon(), func() { pane.copyOutput(-1) })
+	closeButton := widget.NewButtonWithIcon("", theme.CancelIcon(), g.hideDetails)
+
+	header := container.NewVBox(
+		container.NewBorder(nil, nil, nil, closeButton, pane.title),
+		pane.status,
+		container.NewHBox(openButton, copyButton),
+		widget.NewSeparator(),
+	)
+	pane.content = container.NewBorder(header, nil, nil, nil, container.NewVScroll(pane.accordion))
+	pane.refresh()
+	return pane
+}
+
+// schedule redraws the pane soon, at most once per detailRefreshInterval
+func (pane *detailPane) schedule() {
+	if !pane.pending.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(detailRefreshInterval, func() {
+		fyne.Do(func() {
+			pane.pending.Store(false)
+			pane.refresh()
+		})
+	})
+}
+
+// refresh shows the current status and output of the directory; it runs on the main thread
+func (pane *detailPane) refresh() {
+	store := pane.gui.details
+	if store == nil {
+		return
+	}
+	store.mu.Lock()
+	output := store.dir(pane.dir)
+	status := output.status
+	type stepText struct {
+		title, info, stdout, stderr string
+	}
+	steps := make([]stepText, len(output.steps))
+	for i, stepOut := range output.steps {
+		stdout, stderr := stepOut.text()
+		steps[i] = stepText{
+			title:  fmt.Sprintf("%d: %s", stepOut.step, stepOut.command),
+			info:   stepInfo(stepOut),
+			stdout: tail(stdout, detailMaxLines),
+			stderr: tail(stderr, detailMaxLines),
+		}
+		if stepOut.result != nil {
+			steps[i].title += " | " + stepOut.result.Status
+		}
+	}
+	store.mu.Unlock()
+
+	if status == "" {
+		status = "Waiting..."
+	}
+	pane.status.SetText(status)
+
+	for i, step := range steps {
+		if i == len(pane.views) {
+			pane.addStep()
+		}
+		view := pane.views[i]
+		view.item.Title = step.title
+		view.info.SetText(step.info)
+		view.stdout.SetText(orNone(step.stdout))
+		view.stderr.SetText(orNone(step.stderr))
+	}
+	pane.accordion.Refresh()
+}
+
+// addStep appends the view of the next step, opened so that its output shows right away
+func (pane *detailPane) addStep() {
+	index := len(pane.views)
+	view := &stepView{info: widget.NewLabel("")}
+	view.stdout, view.stderr = outputLabel(), outputLabel()
+	copyButton := widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() { pane.copyOutput(index) })
+
+	detail := container.NewVBox(
+		container.NewBorder(nil, nil, nil, copyButton, view.info),
+		widget.NewLabelWithStyle("Stdout", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		outputScroll(view.stdout),
+		widget.NewLabelWithStyle("Stderr", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		outputScroll(view.stderr),
+	)
+	view.item = widget.NewAccordionItem("", detail)
+	pane.views = append(pane.views, view)
+	pane.accordion.Append(view.item)
+	pane.accordion.Open(index)
+}
+
+// copyOutput copies the command and output of a step to the clipboard, or of every step when
+// index is negative
+func (pane *detailPane) copyOutput(index int) {
+	store := pane.gui.details
+	if store == nil {
+		return
+	}
+	var b strings.Builder
+	store.mu.Lock()
+	for i, stepOut := range store.dir(pane.dir).steps {
+		if index >= 0 && i != index {
+			continue
+		}
+		stdout, stderr := stepOut.text()
+		fmt.Fprintf(&b, "Command %d: %s\n", stepOut.step, stepOut.command)
+		fmt.Fprintf(&b, "%s\n", stepInfo(stepOut))
+		fmt.Fprintf(&b, "Stdout:\n%s\nStderr:\n%s\n\n", stdout, stderr)
+	}
+	store.mu.Unlock()
+	pane.gui.app.Clipboard().SetContent(b.String())
+}
+
+// openDirectory shows the directory the commands run in, with the configuration of the run,
+// in the file manager
+func (pane *detailPane) openDirectory() {
+	if pane.gui.runCfg == nil {
+		return
+	}
+	uri, err := url.Parse(storage.NewFileURI(pane.gui.runCfg.WorkDir(pane.dir)).String())
+	if err == nil {
+		err = pane.gui.app.OpenURL(uri)
+	}
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to open %s: %w", pane.dir, err), pane.gui.window)
+	}
+}
+
+// stepInfo describes the exit code, attempts and duration of a finished step, or the attempt
+// of a running one
+func stepInfo(stepOut *stepOutput) string {
+	result := stepOut.result
+	if result == nil {
+		if stepOut.attempt > 1 {
+			return fmt.Sprintf("Running attempt %d...", stepOut.attempt)
+		}
+		return "Running..."
+	}
+	info := fmt.Sprintf("Exit code: %d | Attempts: %d/%d | Duration: %s",
+		result.ExitCode, result.Attempts, result.MaxAttempts, result.Duration.Round(10*time.Millisecond))
+	if result.Error != "" {
+		info += " | Error: " + result.Error
+	}
+	return info
+}
+
+// outputLabel creates a selectable monospace label for command output
+func outputLabel() *widget.Label {
+	label := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	label.Selectable = true
+	return label
+}
+
+// outputScroll wraps output in a scroller of fixed height
+func outputScroll(output fyne.CanvasObject) fyne.CanvasObject {
+	scroll := container.NewScroll(output)
+	scroll.SetMinSize(fyne.NewSize(0, 150))
+	return scroll
+}
+
+// tail returns the last n lines of text
+func tail(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return fmt.Sprintf("(%d earlier lines not shown, use Copy)\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// orNone returns text, or a placeholder when it is empty
+func orNone(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return "(no output)"
+	}
+	return text
+}
+
+// showDetails opens the detail pane of dir next to the progress list
+func (g *GUI) showDetails(dir string) {
+	pane := newDetailPane(g, dir)
+	g.detail.Store(pane)
+	split := container.NewHSplit(g.progressList, pane.content)
+	split.Offset = 0.45
+	g.progressArea.Objects = []fyne.CanvasObject{split}
+	g.progressArea.Refresh()
+}
+
+// hideDetails closes the detail pane, giving the progress list the whole area again
+func (g *GUI) hideDetails() {
+	if g.detail.Swap(nil) == nil {
+		return
+	}
+	g.progressList.UnselectAll()
+	g.progressArea.Objects = []fyne.CanvasObject{g.progressList}
+	g.progressArea.Refresh()
+}
+
+// detailsChanged redraws the detail pane when it shows dir; it is called from any goroutine
+func (g *GUI) detailsChanged(dir string) {
+	if pane := g.detail.Load(); pane != nil && pane.dir == dir {
+		pane.schedule()
+	}
+}
@@ -1,11 +1,14 @@
 package gui
 
 import (
+	"context"
 	"fmt"
 	"image/color"
-	"os"
-	"runtime"
+	"io"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -13,6 +16,7 @@ import (
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
@@ -52,6 +56,16 @@ func (f *fixedWidthLayout) Layout(objects []fyne.CanvasObject, containerSize fyn
 	}
 }
 
+// jobForm holds the input widgets describing a job
+type jobForm struct {
+	dir         *widget.Entry
+	commands    *widget.Entry
+	subdirs     *widget.Entry
+	concurrency *widget.Entry
+	retries     *widget.Entry
+	shell       *widget.Check
+}
+
 type GUI struct {
 	app               fyne.App
 	window            fyne.Window
@@ -59,8 +73,32 @@ type GUI struct {
 	progressList      *widget.List
 	progressData      []string
 	progressColors    map[int]color.Color // Colors for list items
+	progressDirs      []string            // Directory of every list item
+	progressRows      map[string]int      // List item of every directory
+	progressStates    []rowState          // Whether each directory waits, runs or finished
 	cfg               *config.Config
+	runCfg            *config.Config // Copy of cfg used by the current or last run
 	executeButton     *widget.Button
+	stopButton        *widget.Button
+	control           *executor.Controller       // Cancels or skips directories of the current run
+	cancelRun         context.CancelFunc         // Stops the current run
+	stopped           bool                       // The current run was stopped with the Stop button
+	progressArea      *fyne.Container            // Holds the progress list, split with the detail pane when open
+	details           *outputStore               // Steps and output of every directory of the current run
+	detail            atomic.Pointer[detailPane] // Detail pane of the selected directory, nil when closed
+	form              *jobForm
+	scanButton        *widget.Button
+	openButton        *widget.Button
+	saveButton        *widget.Button
+	presetSelect      *widget.Select
+	presetSave        *widget.Button
+	presetDelete      *widget.Button
+	historySelect     *widget.Select
+	history           []string      // Command sets listed in historySelect, the latest first
+	checklist         *dirChecklist // Directories found by Scan, only the checked ones are executed
+	tabs              *container.AppTabs
+	progressTab       *container.TabItem
+	checklistTab      *container.TabItem
 	logArchivePath    string
 	statusLine1       *canvas.Text // First line: "Execution completed"
 	statusLine2       *canvas.Text // Second line: Success/Failure counts
@@ -68,6 +106,15 @@ type GUI struct {
 	statusColor       color.Color  // Current status color
 }
 
+// rowState is the state of a directory in the progress list, deciding its row button
+type rowState int
+
+const (
+	rowWaiting  rowState = iota // Not started, can be skipped
+	rowRunning                  // Running, can be cancelled
+	rowFinished                 // Finished, or a cancel or skip was requested
+)
+
 // LaunchGUI starts the GUI application
 func LaunchGUI() {
 	g := &GUI{
@@ -81,8 +128,11 @@ func LaunchGUI() {
 		statusColor:    color.White,                        // Default status color
 		cfg: &config.Config{
 			Concurrency:        10,
-			Retries:            2,
+			Retry:              guiRetryPolicy(),
 			SubDirsEntryPoints: []string{"functions"},
+			Depth:              1,
+			IgnoreFiles:        []string{directories.DefaultIgnoreFile},
+			Symlinks:           directories.SymlinkSkip,
 		},
 	}
 
@@ -92,15 +142,16 @@ func LaunchGUI() {
 	g.window.ShowAndRun()
 }
 
-func initializeApp() fyne.App {
-	if isRunningOnMacOS() {
-		return app.NewWithID("com.gustavodamazio.mdir-run") // Use specific app ID for macOS
-	}
-	return app.New()
+// guiRetryPolicy is the default retry policy of the GUI, which retries twice
+func guiRetryPolicy() config.RetryPolicy {
+	policy := config.DefaultRetryPolicy()
+	policy.Retries = 2
+	return policy
 }
 
-func isRunningOnMacOS() bool {
-	return runtime.GOOS == "darwin"
+func initializeApp() fyne.App {
+	// The app ID also locates the preferences, which remember the checked directories
+	return app.NewWithID("com.gustavodamazio.mdir-run")
 }
 
 func (g *GUI) buildUI() {
@@ -133,32 +184,73 @@ func (g *GUI) buildUI() {
 
 	// Retries input
 	retriesEntry := widget.NewEntry()
-	retriesEntry.SetText(fmt.Sprintf("%d", g.cfg.Retries))
+	retriesEntry.SetText(fmt.Sprintf("%d", g.cfg.Retry.Retries))
+
+	// Shell mode checkbox
+	shellCheck := widget.NewCheck("Run commands through shell (pipes, redirects, &&)", nil)
+	shellCheck.SetChecked(g.cfg.Shell)
+
+	g.form = &jobForm{
+		dir:         dirEntry,
+		commands:    commandsEntry,
+		subdirs:     subdirsEntry,
+		concurrency: concurrencyEntry,
+		retries:     retriesEntry,
+		shell:       shellCheck,
+	}
+
+	// Presets, saving the whole form under a name
+	g.presetSelect = widget.NewSelect(nil, g.loadPreset)
+	g.presetSelect.PlaceHolder = "(Select a preset)"
+	g.presetSave = widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), g.savePreset)
+	g.presetDelete = widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), g.deletePreset)
+	g.refreshPresets("")
+
+	// History of the executed command sets, reused with a single click
+	g.historySelect = widget.NewSelect(nil, func(string) {
+		g.useHistory(g.historySelect.SelectedIndex())
+	})
+	g.historySelect.PlaceHolder = "(Recently executed commands)"
+	g.refreshHistory()
+
+	// Run file buttons
+	g.openButton = widget.NewButtonWithIcon("Open...", theme.FileIcon(), g.openRunFile)
+	g.saveButton = widget.NewButtonWithIcon("Save...", theme.DocumentSaveIcon(), g.saveRunFile)
+
+	// Scan button, listing the directories to check before executing
+	g.scanButton = widget.NewButtonWithIcon("Scan", theme.SearchIcon(), g.scanDirectories)
 
 	// Execute button
 	g.executeButton = widget.NewButtonWithIcon("Execute", theme.MediaPlayIcon(), func() {
 		// Disable button during execution
 		g.executeButton.Disable()
-		g.executeCommands(dirEntry.Text, commandsEntry.Text, subdirsEntry.Text, concurrencyEntry.Text, retriesEntry.Text)
+		g.executeCommands()
 		// Re-enable button when execution completes (done in startExecution)
 	})
 
+	// Stop button, cancelling the whole run
+	g.stopButton = widget.NewButtonWithIcon("Stop", theme.MediaStopIcon(), g.stopExecution)
+	g.stopButton.Disable()
+
 	// Progress list with colored items
 	g.progressList = widget.NewList(
 		func() int {
 			return len(g.progressData)
 		},
 		func() fyne.CanvasObject {
-			// Create a text object that can be colored
+			// Create a text object that can be colored, and a button to cancel or skip the directory
 			text := canvas.NewText("Template", color.White)
 			text.TextSize = 14
-			return container.NewCenter(text)
+			button := widget.NewButtonWithIcon("", theme.CancelIcon(), nil)
+			return container.NewBorder(nil, nil, nil, button, container.NewCenter(text))
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
 			fyne.Do(func() {
-				// Get the text object from the container
-				text := obj.(*fyne.Container).Objects[0].(*canvas.Text)
+				// Get the text object and the button from the row (center first, then right)
+				row := obj.(*fyne.Container)
+				text := row.Objects[0].(*fyne.Container).Objects[0].(*canvas.Text)
 				text.Text = g.progressData[id]
+				g.updateRowButton(row.Objects[1].(*widget.Button), id)
 				
 				// Set color if one is assigned
 				if c, ok := g.progressColors[id]; ok {
@@ -171,6 +263,19 @@ func (g *GUI) buildUI() {
 			})
 		},
 	)
+	// Clicking a directory shows its steps and output
+	g.progressList.OnSelected = func(id widget.ListItemID) {
+		if id < len(g.progressDirs) {
+			g.showDetails(g.progressDirs[id])
+		}
+	}
+	g.progressArea = container.NewStack(g.progressList)
+
+	// Progress and the directory checklist share the center area
+	g.checklist = newDirChecklist(g)
+	g.progressTab = container.NewTabItem("Progress", g.progressArea)
+	g.checklistTab = container.NewTabItem("Directories", g.checklist.content)
+	g.tabs = container.NewAppTabs(g.progressTab, g.checklistTab)
 
 	// No output text area anymore
 
@@ -180,6 +285,8 @@ func (g *GUI) buildUI() {
 	subdirsLabel := widget.NewLabel("Subdirectories:")
 	concurrencyLabel := widget.NewLabel("Concurrency:")
 	retriesLabel := widget.NewLabel("Retries:")
+	presetLabel := widget.NewLabel("Preset:")
+	historyLabel := widget.NewLabel("History:")
 
 	// Fixed width for labels
 	dirLabelContainer := container.New(&fixedWidthLayout{width: 100}, dirLabel)
@@ -187,15 +294,20 @@ func (g *GUI) buildUI() {
 	subdirsLabelContainer := container.New(&fixedWidthLayout{width: 100}, subdirsLabel)
 	concurrencyLabelContainer := container.New(&fixedWidthLayout{width: 100}, concurrencyLabel)
 	retriesLabelContainer := container.New(&fixedWidthLayout{width: 100}, retriesLabel)
+	presetLabelContainer := container.New(&fixedWidthLayout{width: 100}, presetLabel)
+	historyLabelContainer := container.New(&fixedWidthLayout{width: 100}, historyLabel)
 
 	// Form layout using fixed-width labels and full width entries
 	form := container.NewVBox(
+		container.NewBorder(nil, nil, presetLabelContainer, container.NewHBox(g.presetSave, g.presetDelete), g.presetSelect),
 		container.NewBorder(nil, nil, dirLabelContainer, browseButton, dirEntry),
 		container.NewBorder(nil, nil, cmdLabelContainer, nil, commandsEntry),
+		container.NewBorder(nil, nil, historyLabelContainer, nil, g.historySelect),
 		container.NewBorder(nil, nil, subdirsLabelContainer, nil, subdirsEntry),
 		container.NewHBox(concurrencyLabelContainer, container.New(&fixedWidthLayout{width: 100}, concurrencyEntry)),
 		container.NewHBox(retriesLabelContainer, container.New(&fixedWidthLayout{width: 100}, retriesEntry)),
-		g.executeButton,
+		shellCheck,
+		container.NewBorder(nil, nil, nil, container.NewHBox(g.scanButton, g.stopButton, g.openButton, g.saveButton), g.executeButton),
 	)
 
 	// Status summary at the bottom - configure each line
@@ -235,15 +347,14 @@ func (g *GUI) buildUI() {
 		statusContainer, // Status at the bottom
 		nil,
 		nil,
-		g.progressList, // Progress list takes the full center area
+		g.tabs, // Progress list and checklist take the full center area
 	)
 	g.window.SetContent(content)
 }
 
-func (g *GUI) executeCommands(dirPath, commandsText, subdirs, concurrency, retries string) {
-	// Validate inputs
-	if dirPath == "" {
-		dialog.ShowError(fmt.Errorf("directory path cannot be empty"), g.window)
+func (g *GUI) executeCommands() {
+	if err := g.applyForm(); err != nil {
+		dialog.ShowError(err, g.window)
 		// Re-enable button
 		fyne.Do(func() {
 			g.executeButton.Enable()
@@ -251,59 +362,26 @@ func (g *GUI) executeCommands(dirPath, commandsText, subdirs, concurrency, retri
 		return
 	}
 
-	if commandsText == "" {
-		dialog.ShowError(fmt.Errorf("commands cannot be empty"), g.window)
-		// Re-enable button
+	// Remember the commands, so that they can be run again from the history
+	g.recordHistory(g.form.commands.Text)
+
+	// After a Scan of the directory, only the checked directories run
+	selected := g.checklist.selection(g.cfg.InitialDir)
+	if selected != nil && len(selected) == 0 {
+		dialog.ShowError(fmt.Errorf("no directories are checked in the Directories tab"), g.window)
 		fyne.Do(func() {
 			g.executeButton.Enable()
 		})
 		return
 	}
 
-	// Process commands from GUI (convert newlines to semicolons)
-	commandsStr := strings.ReplaceAll(commandsText, "\n", ";")
-
-	// Convert directory to absolute path if needed
-	if !strings.HasPrefix(dirPath, "/") {
-		currentDir, err := os.Getwd()
-		if err == nil {
-			dirPath = currentDir + "/" + dirPath
-		}
-	}
-
-	// Setup config
-	g.cfg.InitialDir = dirPath
-	g.cfg.LogFile = dirPath + "/script.log"
-
-	// Process concurrency
-	if concurrency != "" {
-		fmt.Sscanf(concurrency, "%d", &g.cfg.Concurrency)
-	}
-
-	// Process retries
-	if retries != "" {
-		fmt.Sscanf(retries, "%d", &g.cfg.Retries)
-	}
-
-	// Process commands
-	commandsStrings := strings.Split(commandsStr, ";")
-	var commands [][]string
-	for _, cmd := range commandsStrings {
-		cmd = strings.TrimSpace(cmd)
-		if cmd == "" {
-			continue
-		}
-		cmdArgs := strings.Fields(cmd)
-		commands = append(commands, cmdArgs)
-	}
-	g.cfg.Commands = commands
-
-	// Process subdirectories
-	if subdirs != "" {
-		g.cfg.SubDirsEntryPoints = []string{}
-		for _, subDir := range strings.Split(subdirs, ";") {
-			g.cfg.SubDirsEntryPoints = append(g.cfg.SubDirsEntryPoints, strings.TrimSpace(subDir))
-		}
+	// Every execution logs to a directory of its own
+	if err := g.cfg.StartRun(); err != nil {
+		dialog.ShowError(err, g.window)
+		fyne.Do(func() {
+			g.executeButton.Enable()
+		})
+		return
 	}
 
 	// Clear progress data and set default colors
@@ -325,120 +403,394 @@ func (g *GUI) executeCommands(dirPath, commandsText, subdirs, concurrency, retri
 	})
 	g.logArchivePath = ""
 
+	// Output of the previous run is no longer shown
+	g.hideDetails()
+	g.details = newOutputStore(g.detailsChanged)
+	g.tabs.Select(g.progressTab)
+
+	// The run uses a copy of the configuration, so that the form can be edited while it runs
+	runCfg := *g.cfg
+	runCfg.Projects = slices.Clone(g.cfg.Projects) // applyForm tokenizes projects in place
+	g.runCfg = &runCfg
+	g.setRunning(true)
+
+	// The run can be stopped as a whole, or directory by directory
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancelRun = cancel
+	g.control = executor.NewController()
+	g.stopped = false
+	g.stopButton.Enable()
+
 	// Start execution in a goroutine
 	go func() {
-		g.startExecution()
+		g.startExecution(ctx, &runCfg, g.control, selected)
 		// The colored completion status is shown via updateCompletionStatus
 	}()
 }
 
-func (g *GUI) startExecution() {
+// stopExecution cancels the current run: running commands are stopped and directories that
+// did not start are marked cancelled
+func (g *GUI) stopExecution() {
+	if g.cancelRun == nil {
+		return
+	}
+	g.stopped = true
+	g.cancelRun()
+	g.stopButton.Disable()
+}
+
+// cancelDirectory cancels the directory of a list item when it runs, or skips it when it waits
+func (g *GUI) cancelDirectory(id widget.ListItemID) {
+	if g.control == nil || id >= len(g.progressDirs) || g.progressStates[id] == rowFinished {
+		return
+	}
+	dir := g.progressDirs[id]
+	if g.control.Cancel(dir) {
+		g.progressData[id] = fmt.Sprintf("%s | Cancelling...", dir)
+	} else {
+		g.progressData[id] = fmt.Sprintf("%s | Skip requested", dir)
+	}
+	g.progressStates[id] = rowFinished
+	g.progressList.RefreshItem(id)
+}
+
+// updateRowButton shows the button of a list item as Cancel while its directory runs, Skip while
+// it waits, and hides it once it finished
+func (g *GUI) updateRowButton(button *widget.Button, id widget.ListItemID) {
+	state := rowFinished
+	if id < len(g.progressStates) {
+		state = g.progressStates[id]
+	}
+	switch state {
+	case rowWaiting:
+		button.SetText("Skip")
+		button.Show()
+	case rowRunning:
+		button.SetText("Cancel")
+		button.Show()
+	default:
+		button.Hide()
+	}
+	button.OnTapped = func() { g.cancelDirectory(id) }
+}
+
+// applyForm validates the form inputs and stores them in the GUI configuration
+func (g *GUI) applyForm() error {
+	commandsText := g.form.commands.Text
+
+	// Validate inputs
+	if err := g.applyDir(); err != nil {
+		return err
+	}
+	if commandsText == "" && len(g.cfg.Projects) == 0 {
+		return fmt.Errorf("commands cannot be empty")
+	}
+
+	// Process commands from GUI (one command per line, semicolons also separate commands)
+	g.cfg.Shell = g.form.shell.Checked
+	if len(g.cfg.ShellInterpreter) == 0 {
+		g.cfg.ShellInterpreter = config.DefaultShellInterpreter()
+	}
+	commands, err := g.cfg.ParseCommands(commandsText)
+	if err != nil {
+		return err
+	}
+	g.cfg.Commands = config.KeepStepSettings(commands, g.cfg.Commands)
+	if err := g.cfg.TokenizeProjects(); err != nil {
+		return err
+	}
+
+	// Process concurrency
+	if g.form.concurrency.Text != "" {
+		fmt.Sscanf(g.form.concurrency.Text, "%d", &g.cfg.Concurrency)
+	}
+
+	// Process retries
+	if g.form.retries.Text != "" {
+		fmt.Sscanf(g.form.retries.Text, "%d", &g.cfg.Retry.Retries)
+	}
+
+	// Process subdirectories
+	g.cfg.SubDirsEntryPoints = []string{}
+	for _, subDir := range strings.Split(g.form.subdirs.Text, ";") {
+		if subDir = strings.TrimSpace(subDir); subDir != "" {
+			g.cfg.SubDirsEntryPoints = append(g.cfg.SubDirsEntryPoints, subDir)
+		}
+	}
+	return nil
+}
+
+// applyDir validates the directory input and stores it in the GUI configuration
+func (g *GUI) applyDir() error {
+	dirPath := g.form.dir.Text
+	if dirPath == "" {
+		return fmt.Errorf("directory path cannot be empty")
+	}
+
+	// Convert directory to a clean absolute path, as the CLI journals it for -resume
+	if absPath, err := filepath.Abs(dirPath); err == nil {
+		dirPath = absPath
+	}
+
+	// Setup config
+	g.cfg.InitialDir = dirPath
+	return nil
+}
+
+// scanDirectories lists the directories that Execute would process in the checklist, so that
+// a subset can be checked
+func (g *GUI) scanDirectories() {
+	if err := g.applyDir(); err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	root := g.cfg.InitialDir
+	g.scanButton.Disable()
+	go func() {
+		dirs, err := g.cfg.Directories()
+		fyne.Do(func() {
+			g.scanButton.Enable()
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("failed to scan %s: %w", root, err), g.window)
+				return
+			}
+			g.checklist.setDirs(root, dirs)
+			g.tabs.Select(g.checklistTab)
+		})
+	}()
+}
+
+// fillForm replaces the form inputs with the values of cfg
+func (g *GUI) fillForm(cfg *config.Config) {
+	lines := make([]string, len(cfg.Commands))
+	for i, command := range cfg.Commands {
+		lines[i] = command.Line
+	}
+
+	g.form.dir.SetText(cfg.InitialDir)
+	g.form.commands.SetText(strings.Join(lines, "\n"))
+	g.form.subdirs.SetText(strings.Join(cfg.SubDirsEntryPoints, ";"))
+	g.form.concurrency.SetText(fmt.Sprintf("%d", cfg.Concurrency))
+	g.form.retries.SetText(fmt.Sprintf("%d", cfg.Retry.Retries))
+	g.form.shell.SetChecked(cfg.Shell)
+}
+
+// openRunFile loads a run file into the form
+func (g *GUI) openRunFile() {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to read run file: %w", err), g.window)
+			return
+		}
+		cfg, err := config.ParseRunFile(data, reader.URI().Path())
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+
+		g.cfg = cfg
+		g.fillForm(cfg)
+	}, g.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".yaml", ".yml", ".toml", ".json"}))
+	fileDialog.Show()
+}
+
+// saveRunFile writes the form to a run file
+func (g *GUI) saveRunFile() {
+	if err := g.applyForm(); err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		data, err := config.EncodeRunFile(g.cfg, writer.URI().Path())
+		if err == nil {
+			_, err = writer.Write(data)
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to save run file: %w", err), g.window)
+		}
+	}, g.window)
+	fileDialog.SetFileName("job.yaml")
+	fileDialog.Show()
+}
+
+// startExecution runs the commands of cfg until they finish or ctx is cancelled, with control
+// cancelling or skipping single directories. When selected is not nil, only the directories
+// it contains are processed.
+func (g *GUI) startExecution(ctx context.Context, cfg *config.Config, control *executor.Controller, selected map[string]bool) {
 	startTime := time.Now()
 
 	// Initialize log file
-	err := logger.InitializeLogFile(g.cfg.LogFile)
+	err := logger.InitializeLogFile(cfg.LogFile)
 	if err != nil {
 		g.updateOutput(fmt.Sprintf("Failed to initialize log file: %v\n", err))
 		// Re-enable execute button on main thread
-		fyne.Do(func() {
-			g.executeButton.Enable()
-		})
+		g.finishExecution()
 		return
 	}
 
 	// Get directories
-	dirs, err := directories.GetDirectories(g.cfg.InitialDir)
+	dirs, err := cfg.Directories()
 	if err != nil {
 		g.updateOutput(fmt.Sprintf("Failed to get directories: %v\n", err))
 		// Re-enable execute button on main thread
-		fyne.Do(func() {
-			g.executeButton.Enable()
-		})
+		g.finishExecution()
 		return
 	}
+	if selected != nil {
+		var checked []string
+		for _, dir := range dirs {
+			if selected[dir] {
+				checked = append(checked, dir)
+			}
+		}
+		dirs = checked
+	}
 
 	// Initialize progress data with white text
-	g.progressData = make([]string, len(dirs))
+	progressData := make([]string, len(dirs))
+	progressRows := make(map[string]int, len(dirs))
 	for i, dir := range dirs {
-		g.progressData[i] = fmt.Sprintf("%s | Waiting...", dir)
-		g.progressColors[i] = color.White // Ensure text starts as white
+		progressData[i] = fmt.Sprintf("%s | Waiting...", dir)
+		progressRows[dir] = i
 	}
 	fyne.Do(func() {
+		g.progressData = progressData
+		g.progressDirs = dirs
+		g.progressRows = progressRows
+		g.progressStates = make([]rowState, len(dirs))
+		for i := range dirs {
+			g.progressColors[i] = color.White // Ensure text starts as white
+		}
 		g.progressList.Refresh()
 	})
 
-	// Create a custom progress manager that updates the GUI
-	progressManager := NewGUIProgressManager(dirs, g)
+	// Show every status change of the executor in the progress list
+	progressManager := progress.NewProgressManager(dirs)
+	progressManager.AddReporter(&guiReporter{gui: g, output: g.details})
+
+	// Journal every finished step, so that an interrupted run can be resumed from the CLI
+	journal, err := progress.CreateJournal(cfg.LogFile, cfg.JournalRun(dirs))
+	if err != nil {
+		g.updateOutput(fmt.Sprintf("WARNING: %v\n", err))
+	} else {
+		progressManager.SetJournal(journal)
+	}
 
 	// Execute commands
-	executor.ExecuteCommands(dirs, g.cfg, &progressManager.ProgressManager)
+	if err := executor.ExecuteCommands(ctx, dirs, cfg, progressManager, control); err != nil {
+		g.updateOutput(fmt.Sprintf("Run stopped early: %v\n", err))
+	}
+	if journal != nil {
+		if ctx.Err() == nil {
+			journal.Finish()
+		}
+		journal.Close()
+	}
 
-	// We don't need to forcibly update statuses at the end because
-	// the progress manager already properly updates the status
-	// via the GUIProgressManager.UpdateProgress method.
-	// Any remaining "Waiting..." statuses indicate directories that weren't processed.
-	
-	// For backward compatibility, update any remaining "Waiting..." entries
-	var updatedIndexes []int
-	var updatedValues []string
-
-	for i, statusText := range g.progressData {
-		if strings.Contains(statusText, "Waiting...") {
-			dirName := strings.Split(statusText, " | ")[0]
-			// Get the real status from progress manager if available
-			progress := progressManager.GetProgress(dirName)
-			
-			updatedIndexes = append(updatedIndexes, i)
-			if progress != nil && progress.Status != "Processing" {
-				updatedValues = append(updatedValues, fmt.Sprintf("%s | %s", dirName, progress.Status))
+	// The guiReporter shows every status as it changes; directories the executor never
+	// reached still read "Waiting..." and get their final status here
+	fyne.Do(func() {
+		for i, dir := range g.progressDirs {
+			if g.progressStates[i] != rowWaiting {
+				continue
+			}
+			if dirProgress := progressManager.GetProgress(dir); dirProgress != nil && dirProgress.Status != progress.StatusProcessing {
+				g.progressData[i] = fmt.Sprintf("%s | %s", dir, dirProgress.Status)
 			} else {
-				// Fallback if no status is available
-				updatedValues = append(updatedValues, fmt.Sprintf("%s | Not processed", dirName))
+				g.progressData[i] = fmt.Sprintf("%s | Not processed", dir)
 			}
 		}
-	}
+		g.progressList.Refresh()
+	})
 
-	// Apply updates in the main thread
-	if len(updatedIndexes) > 0 {
-		fyne.Do(func() {
-			for j, idx := range updatedIndexes {
-				g.progressData[idx] = updatedValues[j]
-			}
-			g.progressList.Refresh()
-		})
+	// Write summary log and result manifest
+	interrupted := ctx.Err() != nil
+	logger.WriteSummaryLog(cfg.LogFile, startTime, interrupted)
+	manifest := progressManager.Manifest(cfg.InitialDir, startTime)
+	manifest.RunID = cfg.RunID
+	if err := progress.WriteManifest(cfg.LogFile, manifest); err != nil {
+		g.updateOutput(fmt.Sprintf("WARNING: %v\n", err))
 	}
 
-	// Write summary log
-	logger.WriteSummaryLog(g.cfg.LogFile, startTime)
-
 	// Archive logs
 	var archivePath string
-	if archivePath, err = logger.ArchiveLogs(g.cfg.LogFile); err != nil {
+	if archivePath, err = logger.ArchiveLogs(cfg.LogFile, cfg.ArchiveFormat, cfg.KeepRawLogs || interrupted); err != nil {
 		g.updateOutput(fmt.Sprintf("WARNING: Failed to archive log files: %v\n", err))
 	} else {
 		g.logArchivePath = archivePath
 	}
+	if _, err := cfg.PruneRuns(); err != nil {
+		g.updateOutput(fmt.Sprintf("WARNING: Failed to delete old logs: %v\n", err))
+	}
 	
 	// Update completion status with color
-	g.updateCompletionStatus()
+	g.updateCompletionStatus(cfg, progressManager.Results())
 
 	// Re-enable execute button
+	g.finishExecution()
+}
+
+// finishExecution re-enables the Execute button and releases the controls of the finished run
+func (g *GUI) finishExecution() {
 	fyne.Do(func() {
+		if g.cancelRun != nil {
+			g.cancelRun() // Releases the context of the run
+		}
+		g.cancelRun = nil
+		g.control = nil
+		g.stopButton.Disable()
+		for i := range g.progressStates {
+			g.progressStates[i] = rowFinished
+		}
+		g.progressList.Refresh()
+		g.setRunning(false)
 		g.executeButton.Enable()
 	})
 }
 
-func (g *GUI) updateProgress(dir string, status string) {
+// setRunning disables the controls that replace or change the configuration while a run is
+// in progress, and enables them again once it finished
+func (g *GUI) setRunning(running bool) {
+	controls := []fyne.Disableable{
+		g.openButton, g.saveButton,
+		g.presetSelect, g.presetSave, g.presetDelete, g.historySelect,
+	}
+	for _, control := range controls {
+		if running {
+			control.Disable()
+		} else {
+			control.Enable()
+		}
+	}
+}
+
+func (g *GUI) updateProgress(dir string, status string, state rowState) {
 	// UI updates using fyne.Do to ensure the use of the main thread
 	fyne.Do(func() {
-		// Find the directory in progress data
-		for i, d := range g.progressData {
-			if strings.HasPrefix(d, dir+" |") {
-				g.progressData[i] = status
-				break
-			}
+		i, ok := g.progressRows[dir]
+		if !ok {
+			return
 		}
-		g.progressList.Refresh()
+		// A cancel or skip request stays shown until the directory finishes
+		if g.progressStates[i] == rowFinished && state != rowFinished {
+			return
+		}
+		g.progressData[i] = status
+		g.progressStates[i] = state
+		g.progressList.RefreshItem(i)
 	})
 }
 
@@ -447,78 +799,90 @@ func (g *GUI) updateOutput(text string) {
 	// This method is kept for compatibility with existing code
 }
 
-// Custom progress manager for GUI
-type GUIProgressManager struct {
-	progress.ProgressManager
-	gui *GUI
-}
-
-func NewGUIProgressManager(dirs []string, gui *GUI) *GUIProgressManager {
-	pm := &GUIProgressManager{
-		ProgressManager: *progress.NewProgressManager(dirs),
-		gui:             gui,
-	}
-	return pm
-}
-
-// updateCompletionStatus analyzes all progress items and updates the status summary with appropriate color
-func (g *GUI) updateCompletionStatus() {
+// updateCompletionStatus analyzes all progress items of the run of cfg and updates the status summary with appropriate color
+func (g *GUI) updateCompletionStatus(cfg *config.Config, results []progress.Progress) {
 	// Count successes and failures
 	successCount := 0
 	failCount := 0
+	skippedCount := 0
+	cancelledCount := 0
 	
 	// Define colors
 	successColor := color.RGBA{0, 180, 0, 255}   // Green
 	mixedColor := color.RGBA{255, 140, 0, 255}   // Orange
 	failColor := color.RGBA{220, 20, 20, 255}    // Red
 	
-	// Analyze progress data
-	for i, status := range g.progressData {
-		if strings.Contains(status, "SUCCESS") {
+	// Analyze the results, listed in the order of the progress list
+	itemColors := make(map[int]color.Color)
+	for i, result := range results {
+		switch progress.Result(result.Status) {
+		case progress.ResultSuccess:
 			successCount++
 			// Color successful items green
-			g.progressColors[i] = successColor
-		} else if strings.Contains(status, "FAIL") {
+			itemColors[i] = successColor
+		case progress.ResultFailed, progress.ResultTimeout:
 			failCount++
 			// Color failed items red
-			g.progressColors[i] = failColor
+			itemColors[i] = failColor
+		case progress.ResultSkipped:
+			skippedCount++
+		case progress.ResultCancelled, progress.ResultUnprocessed:
+			cancelledCount++
 		}
 	}
 	
-	// Prepare the three separate status lines
-	line1Text := "--- Execution completed ---"
+	// Prepare the three separate status lines; line 1 is set on the main thread, where Stop is handled
 	
 	// Line 2: Success/failure stats
 	line2Text := ""
-	totalItems := len(g.progressData)
+	totalItems := len(results)
 	if totalItems > 0 {
 		line2Text = fmt.Sprintf("Success: %d/%d | Failure: %d/%d", 
 			successCount, totalItems, failCount, totalItems)
+		if skippedCount > 0 {
+			line2Text += fmt.Sprintf(" | Skipped: %d/%d", skippedCount, totalItems)
+		}
+		if cancelledCount > 0 {
+			line2Text += fmt.Sprintf(" | Cancelled: %d/%d", cancelledCount, totalItems)
+		}
 	}
 	
 	// Line 3: Log file path
 	line3Text := ""
 	if g.logArchivePath != "" {
 		line3Text = fmt.Sprintf("Log files archived in: %s", g.logArchivePath)
+	} else if cfg.ArchiveFormat == logger.ArchiveNone && cfg.LogFile != "" {
+		line3Text = fmt.Sprintf("Log files kept in: %s", filepath.Dir(cfg.LogFile))
 	}
 	
 	// Determine the appropriate color based on results
+	var statusColor color.Color
 	if failCount == 0 && successCount > 0 {
 		// All succeeded
-		g.statusColor = successColor
+		statusColor = successColor
 	} else if successCount == 0 && failCount > 0 {
 		// All failed
-		g.statusColor = failColor
+		statusColor = failColor
 	} else if successCount > 0 && failCount > 0 {
 		// Mixed results
-		g.statusColor = mixedColor
+		statusColor = mixedColor
 	} else {
 		// No results or other case
-		g.statusColor = color.White
+		statusColor = color.White
 	}
 	
 	// Update UI on main thread
 	fyne.Do(func() {
+		// Line 1: Completed or stopped
+		line1Text := "--- Execution completed ---"
+		if g.stopped {
+			line1Text = "--- Execution stopped ---"
+		}
+		for i, itemColor := range itemColors {
+			g.progressColors[i] = itemColor
+		}
+		g.statusColor = statusColor
+
 		// Update all three status lines with the same color
 		g.statusLine1.Text = line1Text
 		g.statusLine1.Color = g.statusColor
@@ -542,27 +906,43 @@ func (g *GUI) updateCompletionStatus() {
 	})
 }
 
-func (pm *GUIProgressManager) UpdateProgress(dir string, progress *progress.Progress) {
-	// Update underlying progress manager
-	pm.ProgressManager.UpdateProgress(dir, progress)
+// guiReporter shows the progress of the executor in the progress list as it happens
+type guiReporter struct {
+	gui    *GUI
+	output *outputStore // Collects the steps and output shown in the detail pane
+}
 
-	// Update GUI
-	status := fmt.Sprintf("%s | ", dir)
-	if progress.Status == "Processing" {
-		if progress.Total > 0 {
-			status += fmt.Sprintf("step: %d/%d | command: %s", progress.Step, progress.Total, progress.Command)
+// Update shows the current step or the final status of a directory
+func (r *guiReporter) Update(dirProgress *progress.Progress) {
+	status := ""
+	state := rowFinished
+	if dirProgress.Status == progress.StatusProcessing {
+		state = rowWaiting
+		if !dirProgress.Started.IsZero() {
+			state = rowRunning
+		}
+		if dirProgress.Total > 0 {
+			status = fmt.Sprintf("step: %d/%d | command: %s", dirProgress.Step, dirProgress.Total, dirProgress.Command)
 		} else {
-			status += progress.Command
+			status = dirProgress.Command
 		}
-	} else if progress.Status == "FAIL" || strings.HasPrefix(progress.Status, "FAIL(") {
-		status += fmt.Sprintf("%s: %s", progress.Status, progress.Command)
-		// We no longer need to update the output text
-	} else if progress.Status == "SUCCESS" || strings.HasPrefix(progress.Status, "SUCCESS(") {
-		status += fmt.Sprintf("%s", progress.Status)
-		// We no longer need to update the output text
+	} else if progress.IsFailure(dirProgress.Status) ||
+		dirProgress.Status == progress.StatusCancelled || dirProgress.Status == progress.StatusSkipped {
+		status = fmt.Sprintf("%s: %s", dirProgress.Status, dirProgress.Command)
 	} else {
-		status += progress.Status
+		status = dirProgress.Status
 	}
 
-	pm.gui.updateProgress(dir, status)
+	r.output.update(dirProgress, status)
+	r.gui.updateProgress(dirProgress.Dir, fmt.Sprintf("%s | %s", dirProgress.Dir, status), state)
+}
+
+// StepOutput collects the output of a step for the detail pane, line by line
+func (r *guiReporter) StepOutput(dir string, step int) (stdout, stderr *progress.LineWriter) {
+	return r.output.writers(dir, step)
+}
+
+// StepFinished records the exit code, attempts, duration and complete output of a step
+func (r *guiReporter) StepFinished(dir string, result progress.StepResult) {
+	r.output.finished(dir, result)
 }
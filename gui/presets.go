@@ -0,0 +1,171 @@
+package gui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/gustavodamazio/mdir-run/config"
+)
+
+// Preference keys of the presets and the command history
+const (
+	presetNamesPreference = "presets"         // Names of the saved presets, sorted
+	presetPreference      = "preset:"         // Followed by a preset name, its form as a YAML run file
+	historyPreference     = "command_history" // Recently executed command sets, the latest first
+)
+
+// presetFile is the name presets are encoded and parsed with, choosing the run file format
+const presetFile = "preset.yaml"
+
+// maxHistory is the number of command sets kept in the history
+const maxHistory = 10
+
+// historyLabelLength limits the length of the history entries shown in the dropdown
+const historyLabelLength = 60
+
+// presetNames returns the names of the saved presets
+func (g *GUI) presetNames() []string {
+	return g.app.Preferences().StringList(presetNamesPreference)
+}
+
+// loadPreset fills the form with the preset name
+func (g *GUI) loadPreset(name string) {
+	if name == "" {
+		return
+	}
+	data := g.app.Preferences().String(presetPreference + name)
+	if data == "" {
+		dialog.ShowError(fmt.Errorf("preset %q not found", name), g.window)
+		return
+	}
+	cfg, err := config.ParseRunFile([]byte(data), presetFile)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to load preset %q: %w", name, err), g.window)
+		return
+	}
+	g.cfg = cfg
+	g.fillForm(cfg)
+}
+
+// savePreset asks for a name and saves the form under it, replacing a preset of the same name
+func (g *GUI) savePreset() {
+	if err := g.applyForm(); err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(g.presetSelect.Selected)
+	nameEntry.Validator = func(name string) error {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("preset name cannot be empty")
+		}
+		return nil
+	}
+	items := []*widget.FormItem{widget.NewFormItem("Name", nameEntry)}
+	dialog.ShowForm("Save preset", "Save", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		name := strings.TrimSpace(nameEntry.Text)
+		data, err := config.EncodeRunFile(g.cfg, presetFile)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to save preset %q: %w", name, err), g.window)
+			return
+		}
+
+		prefs := g.app.Preferences()
+		prefs.SetString(presetPreference+name, string(data))
+		names := g.presetNames()
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+			slices.Sort(names)
+			prefs.SetStringList(presetNamesPreference, names)
+		}
+		g.refreshPresets(name)
+	}, g.window)
+}
+
+// deletePreset removes the selected preset after confirmation
+func (g *GUI) deletePreset() {
+	name := g.presetSelect.Selected
+	if name == "" {
+		return
+	}
+	dialog.ShowConfirm("Delete preset", fmt.Sprintf("Delete the preset %q?", name), func(ok bool) {
+		if !ok {
+			return
+		}
+		prefs := g.app.Preferences()
+		prefs.RemoveValue(presetPreference + name)
+		var names []string
+		for _, other := range g.presetNames() {
+			if other != name {
+				names = append(names, other)
+			}
+		}
+		prefs.SetStringList(presetNamesPreference, names)
+		g.refreshPresets("")
+	}, g.window)
+}
+
+// refreshPresets lists the saved presets in the dropdown, showing selected as chosen
+func (g *GUI) refreshPresets(selected string) {
+	onChanged := g.presetSelect.OnChanged
+	g.presetSelect.OnChanged = nil // Showing the saved preset must not load it again
+	g.presetSelect.SetOptions(g.presetNames())
+	if selected == "" {
+		g.presetSelect.ClearSelected()
+	} else {
+		g.presetSelect.SetSelected(selected)
+	}
+	g.presetSelect.OnChanged = onChanged
+}
+
+// recordHistory adds the executed commands at the top of the history
+func (g *GUI) recordHistory(commands string) {
+	commands = strings.TrimSpace(commands)
+	if commands == "" {
+		return
+	}
+	history := []string{commands}
+	for _, previous := range g.app.Preferences().StringList(historyPreference) {
+		if previous != commands && len(history) < maxHistory {
+			history = append(history, previous)
+		}
+	}
+	g.app.Preferences().SetStringList(historyPreference, history)
+	g.refreshHistory()
+}
+
+// refreshHistory lists the recent command sets in the dropdown, one line each
+func (g *GUI) refreshHistory() {
+	g.history = g.app.Preferences().StringList(historyPreference)
+	labels := make([]string, len(g.history))
+	for i, commands := range g.history {
+		labels[i] = historyText(i, commands)
+	}
+	g.historySelect.SetOptions(labels)
+}
+
+// useHistory puts the command set of a history entry in the form
+func (g *GUI) useHistory(index int) {
+	if index < 0 || index >= len(g.history) {
+		return
+	}
+	g.form.commands.SetText(g.history[index])
+	g.historySelect.ClearSelected() // The same entry can be picked again
+}
+
+// historyText shows the commands of a history entry on a single numbered line
+func historyText(index int, commands string) string {
+	label := strings.Join(strings.Split(commands, "\n"), "; ")
+	if runes := []rune(label); len(runes) > historyLabelLength {
+		label = string(runes[:historyLabelLength-3]) + "..."
+	}
+	return fmt.Sprintf("%d. %s", index+1, label)
+}
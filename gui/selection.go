@@ -0,0 +1,149 @@
+package gui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// uncheckedPreference is the preference key prefix of the directories unchecked under a root,
+// followed by the root; directories found later start checked
+const uncheckedPreference = "unchecked_dirs:"
+
+// dirChecklist lists the directories found by Scan, so that only the checked ones are executed
+type dirChecklist struct {
+	gui       *GUI
+	root      string          // Directory scanned, empty before the first scan
+	dirs      []string        // Directories found by the scan, in processing order
+	unchecked map[string]bool // Directories left out of the run
+	visible   []string        // Directories matching the filter
+	filter    *widget.Entry
+	list      *widget.List
+	count     *widget.Label
+	content   fyne.CanvasObject
+}
+
+// newDirChecklist creates the empty checklist, filled by setDirs
+func newDirChecklist(g *GUI) *dirChecklist {
+	c := &dirChecklist{gui: g, unchecked: make(map[string]bool)}
+
+	c.filter = widget.NewEntry()
+	c.filter.SetPlaceHolder("Filter directories...")
+	c.filter.OnChanged = func(string) { c.applyFilter() }
+
+	c.list = widget.NewList(
+		func() int {
+			return len(c.visible)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewCheck("Template", nil)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			check := obj.(*widget.Check)
+			dir := c.visible[id]
+			check.OnChanged = nil // Showing the state must not change it
+			check.Text = dir
+			check.SetChecked(!c.unchecked[dir])
+			check.OnChanged = func(checked bool) {
+				c.unchecked[dir] = !checked
+				c.changed()
+			}
+		},
+	)
+
+	c.count = widget.NewLabel("Press Scan to list the directories of the chosen folder")
+	allButton := widget.NewButton("All", func() { c.setVisible(func(bool) bool { return true }) })
+	noneButton := widget.NewButton("None", func() { c.setVisible(func(bool) bool { return false }) })
+	invertButton := widget.NewButton("Invert", func() { c.setVisible(func(checked bool) bool { return !checked }) })
+
+	header := container.NewVBox(
+		container.NewBorder(nil, nil, nil, container.NewHBox(allButton, noneButton, invertButton), c.filter),
+		c.count,
+	)
+	c.content = container.NewBorder(header, nil, nil, nil, c.list)
+	return c
+}
+
+// setDirs shows the directories found under root, checked as they were the last time root was
+// scanned
+func (c *dirChecklist) setDirs(root string, dirs []string) {
+	c.root = root
+	c.dirs = dirs
+	c.unchecked = make(map[string]bool)
+	for _, dir := range c.gui.app.Preferences().StringList(uncheckedPreference + root) {
+		c.unchecked[dir] = true
+	}
+	c.applyFilter()
+}
+
+// applyFilter shows the directories whose path contains the filter text, ignoring case
+func (c *dirChecklist) applyFilter() {
+	filter := strings.ToLower(strings.TrimSpace(c.filter.Text))
+	c.visible = nil
+	for _, dir := range c.dirs {
+		if strings.Contains(strings.ToLower(dir), filter) {
+			c.visible = append(c.visible, dir)
+		}
+	}
+	c.list.Refresh()
+	c.updateCount()
+}
+
+// setVisible changes the check of every directory matching the filter
+func (c *dirChecklist) setVisible(checked func(bool) bool) {
+	for _, dir := range c.visible {
+		c.unchecked[dir] = !checked(!c.unchecked[dir])
+	}
+	c.list.Refresh()
+	c.changed()
+}
+
+// changed remembers the selection of the root and updates the count
+func (c *dirChecklist) changed() {
+	var unchecked []string
+	for dir, excluded := range c.unchecked {
+		if excluded {
+			unchecked = append(unchecked, dir)
+		}
+	}
+	sort.Strings(unchecked)
+	c.gui.app.Preferences().SetStringList(uncheckedPreference+c.root, unchecked)
+	c.updateCount()
+}
+
+// updateCount shows how many directories are checked
+func (c *dirChecklist) updateCount() {
+	if c.root == "" {
+		return
+	}
+	checked := 0
+	for _, dir := range c.dirs {
+		if !c.unchecked[dir] {
+			checked++
+		}
+	}
+	text := fmt.Sprintf("%d of %d directories checked in %s", checked, len(c.dirs), c.root)
+	if len(c.visible) != len(c.dirs) {
+		text += fmt.Sprintf(" (%d shown)", len(c.visible))
+	}
+	c.count.SetText(text)
+}
+
+// selection returns the checked directories of root, or nil when root was not scanned and
+// every directory is to be processed
+func (c *dirChecklist) selection(root string) map[string]bool {
+	if c.root == "" || c.root != root {
+		return nil
+	}
+	selected := make(map[string]bool)
+	for _, dir := range c.dirs {
+		if !c.unchecked[dir] {
+			selected[dir] = true
+		}
+	}
+	return selected
+}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirLogsDir is the folder next to the main log file holding the logs of every directory, in
+// a tree that mirrors the processed paths
+const DirLogsDir = "dirs"
+
+// IndexFile is the name of the index mapping every directory to its log file, written next to
+// the main log file
+const IndexFile = "index.json"
+
+// IndexVersion is the schema version of IndexFile
+const IndexVersion = 1
+
+// Names of the log files inside the folder of a directory
+const (
+	successLogName = "success.txt"
+	errorLogName   = "error.txt"
+)
+
+// logIndex is the content of IndexFile
+type logIndex struct {
+	Version int               `json:"version"`
+	Logs    map[string]string `json:"logs"` // Log file of every directory, relative to the log directory
+}
+
+// DirLogFile returns the path of the success or error log of dir, relative to the directory of
+// the main log file, e.g. dirs/apps/api/error.txt
+func DirLogFile(dir string, success bool) string {
+	name := errorLogName
+	if success {
+		name = successLogName
+	}
+	return filepath.Join(DirLogsDir, dirLogFolder(dir), name)
+}
+
+// dirLogFolder encodes a directory path into a relative folder path, one escaped segment per
+// path element. The encoding is reversible, so that different directories never share a
+// folder: absolute paths start with a %2F segment, which no relative path can produce
+func dirLogFolder(dir string) string {
+	var segments []string
+	path := filepath.ToSlash(filepath.Clean(dir))
+	if filepath.IsAbs(dir) || strings.HasPrefix(path, "/") {
+		segments = append(segments, "%2F")
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, escapeSegment(segment))
+		}
+	}
+	if len(segments) == 0 {
+		segments = append(segments, escapeSegment("."))
+	}
+	return filepath.Join(segments...)
+}
+
+// escapeSegment percent-encodes the characters of a path element that are not portable in file
+// names, as well as the first character of names that would clash with "." or the log files
+func escapeSegment(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		reserved := i == 0 && (segment == "." || segment == ".." || segment == successLogName || segment == errorLogName)
+		if reserved || c < 0x20 || c == 0x7f || strings.IndexByte(`%/\:*?"<>|`, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// writeDirLog creates the success or error log of dir with content, and records it in the index
+func writeDirLog(logFile, dir string, success bool, content string) error {
+	logDir := filepath.Dir(logFile)
+	name := DirLogFile(dir, success)
+	path := filepath.Join(logDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log folder: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	return updateIndex(logDir, dir, name)
+}
+
+// updateIndex records the log file of dir in the index, or removes dir when name is empty
+func updateIndex(logDir, dir, name string) error {
+	index := logIndex{Version: IndexVersion, Logs: make(map[string]string)}
+	path := filepath.Join(logDir, IndexFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read log index: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("%s: invalid log index: %w", path, err)
+		}
+		if index.Logs == nil {
+			index.Logs = make(map[string]string)
+		}
+	}
+
+	if name == "" {
+		delete(index.Logs, dir)
+	} else {
+		index.Logs[dir] = filepath.ToSlash(name)
+	}
+	data, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode log index: %w", err)
+	}
+
+	// Replace the index at once, so that readers never see it half written
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write log index: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("failed to write log index: %w", err)
+	}
+	return nil
+}
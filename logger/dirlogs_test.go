@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirLogFile(t *testing.T) {
+	tests := []struct {
+		dir     string
+		success bool
+		want    string
+	}{
+		{"api", false, "dirs/api/error.txt"},
+		{"api", true, "dirs/api/success.txt"},
+		{"apps/api", false, "dirs/apps/api/error.txt"},
+		{"apps/api/", false, "dirs/apps/api/error.txt"},
+		{"/srv/apps/api", false, "dirs/%2F/srv/apps/api/error.txt"},
+		{".", false, "dirs/%2E/error.txt"},
+		{"apps/..x", false, "dirs/apps/..x/error.txt"},
+		{"error.txt", true, "dirs/%65rror.txt/success.txt"},
+		{"50%/a:b", false, "dirs/50%25/a%3Ab/error.txt"},
+		{`a*?"<>|b`, false, "dirs/a%2A%3F%22%3C%3E%7Cb/error.txt"},
+		{"%2F", false, "dirs/%252F/error.txt"},
+	}
+	for _, tt := range tests {
+		if got := filepath.ToSlash(DirLogFile(tt.dir, tt.success)); got != tt.want {
+			t.Errorf("DirLogFile(%q, %t) = %s, want %s", tt.dir, tt.success, got, tt.want)
+		}
+	}
+}
+
+func TestDirLogFileUnique(t *testing.T) {
+	// Directories that collided when logs were named after the last path element
+	dirs := []string{"api", "apps/api", "services/api", "/srv/api", "srv/api", "%2F/srv/api", "a%2Fb", "a/b", ".", "%2E"}
+	seen := make(map[string]string)
+	for _, dir := range dirs {
+		name := DirLogFile(dir, false)
+		if other, ok := seen[name]; ok {
+			t.Errorf("%q and %q share the log %s", dir, other, name)
+		}
+		seen[name] = dir
+	}
+}
+
+func TestDirLogIndex(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "script.log")
+	WriteErrorLog(logFile, "apps/api", "Command: make\nStderr Output:\nboom")
+	WriteSuccessLog(logFile, "apps/web", "done")
+	WriteSuccessLog(logFile, "apps/api", "fixed")
+	RemoveDirLogs(logFile, "apps/web")
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(logFile), IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index logIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"apps/api": "dirs/apps/api/success.txt"}
+	if index.Version != IndexVersion || len(index.Logs) != len(want) || index.Logs["apps/api"] != want["apps/api"] {
+		t.Errorf("index %+v, want version %d with %v", index, IndexVersion, want)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(logFile), "dirs", "apps", "web", "success.txt")); err == nil {
+		t.Error("log of apps/web left after RemoveDirLogs")
+	}
+}
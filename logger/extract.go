@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ManifestFile is the name of the machine-readable result manifest written next to the main log file
+const ManifestFile = "results.json"
+
+// ReportFile is the name of the HTML report written next to the main log file
+const ReportFile = "report.html"
+
+// JournalFile is the name of the journal of finished steps written next to the main log file
+const JournalFile = "journal.jsonl"
+
+// JournalFinished is the journal event recorded once a run completed; a journal without it
+// belongs to a run that was interrupted or is still executing
+const JournalFinished = "finished"
+
+// ReadArchivedFile returns the content of the file called name inside a log archive
+// created by ArchiveLogs
+func ReadArchivedFile(archivePath, name string) ([]byte, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		return readFromZip(archivePath, name)
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return readFromTar(archivePath, name, func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+	case strings.HasSuffix(archivePath, ".tar.zst"):
+		return readFromTar(archivePath, name, func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		})
+	}
+	return nil, fmt.Errorf("%s: unsupported archive format", archivePath)
+}
+
+// readFromZip returns the content of a file in a zip archive
+func readFromZip(archivePath, name string) ([]byte, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in zip: %w", name, err)
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return nil, fmt.Errorf("%s: %s not found in archive", archivePath, name)
+}
+
+// readFromTar returns the content of a file in a tar archive, decompressed by the reader
+// returned by decompress
+func readFromTar(archivePath, name string, decompress func(io.Reader) (io.ReadCloser, error)) ([]byte, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tar file: %w", err)
+	}
+	defer file.Close()
+
+	decompressor, err := decompress(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compressed stream: %w", err)
+	}
+	defer decompressor.Close()
+
+	tarReader := tar.NewReader(decompressor)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %s not found in archive", archivePath, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar file: %w", err)
+		}
+		if header.Name == name {
+			return io.ReadAll(tarReader)
+		}
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 var logMutex sync.Mutex
@@ -37,6 +41,37 @@ func InitializeLogFile(logFile string) error {
 	return nil
 }
 
+// ResumeLogFile appends a header marking where a resumed run continues the log file
+// of an interrupted one
+func ResumeLogFile(logFile string) error {
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	header := fmt.Sprintf("\nExecution resumed on %s\n", time.Now().Format("02/01/2006 15:04:05"))
+	if _, err := f.WriteString(header); err != nil {
+		return fmt.Errorf("failed to write to log file: %w", err)
+	}
+	return nil
+}
+
+// RemoveDirLogs removes the success and error logs of a directory, left by an interrupted
+// run, before it is processed again
+func RemoveDirLogs(logFile, dir string) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	logDir := filepath.Dir(logFile)
+	for _, success := range []bool{true, false} {
+		os.Remove(filepath.Join(logDir, DirLogFile(dir, success)))
+	}
+	if err := updateIndex(logDir, dir, ""); err != nil {
+		fmt.Printf("%s | WARNING: %s\n", dir, err)
+	}
+}
+
 func WriteLog(logFile, status string, executionTime float64, dir string) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
@@ -58,16 +93,6 @@ func WriteErrorLog(logFile, dir string, errorDetails string) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
-	logDir := filepath.Dir(logFile)
-	errorFileName := filepath.Join(logDir, fmt.Sprintf("%s_error.txt", filepath.Base(dir)))
-	
-	f, err := os.Create(errorFileName)
-	if err != nil {
-		fmt.Printf("%s | ERROR: Failed to create error log file: %s\n", dir, err)
-		return
-	}
-	defer f.Close()
-
 	timestamp := time.Now().Format("02/01/2006 15:04:05")
 	header := fmt.Sprintf("Error log for directory '%s' created on %s\n\n", dir, timestamp)
 	
@@ -82,7 +107,7 @@ func WriteErrorLog(logFile, dir string, errorDetails string) {
 	
 	content := header + errorDetails
 	
-	if _, err := f.WriteString(content); err != nil {
+	if err := writeDirLog(logFile, dir, false, content); err != nil {
 		fmt.Printf("%s | ERROR: Failed to write to error log file: %s\n", dir, err)
 	}
 }
@@ -91,28 +116,19 @@ func WriteSuccessLog(logFile, dir string, executionDetails string) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
-	logDir := filepath.Dir(logFile)
-	successFileName := filepath.Join(logDir, fmt.Sprintf("%s_success.txt", filepath.Base(dir)))
-	
-	f, err := os.Create(successFileName)
-	if err != nil {
-		fmt.Printf("%s | ERROR: Failed to create success log file: %s\n", dir, err)
-		return
-	}
-	defer f.Close()
-
 	timestamp := time.Now().Format("02/01/2006 15:04:05")
 	header := fmt.Sprintf("Success log for directory '%s' created on %s\n\n", dir, timestamp)
 	
 	content := header + executionDetails
 	
-	if _, err := f.WriteString(content); err != nil {
+	if err := writeDirLog(logFile, dir, true, content); err != nil {
 		fmt.Printf("%s | ERROR: Failed to write to success log file: %s\n", dir, err)
 	}
 }
 
-// WriteSummaryLog writes a final summary line to the log file with the execution end date and total time
-func WriteSummaryLog(logFile string, startTime time.Time) {
+// WriteSummaryLog writes a final summary line to the log file with the execution end date and total time,
+// telling whether the run completed or was interrupted
+func WriteSummaryLog(logFile string, startTime time.Time, interrupted bool) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
@@ -131,35 +147,87 @@ func WriteSummaryLog(logFile string, startTime time.Time) {
 	seconds := int(executionDuration.Seconds()) % 60
 	durationStr := fmt.Sprintf("%dm %ds", minutes, seconds)
 	
-	summaryLine := fmt.Sprintf("\nExecution completed on %s | Total execution time: %s\n", 
-		endTime.Format("02/01/2006 15:04:05"), durationStr)
+	outcome := "completed"
+	if interrupted {
+		outcome = "interrupted"
+	}
+	summaryLine := fmt.Sprintf("\nExecution %s on %s | Total execution time: %s\n", 
+		outcome, endTime.Format("02/01/2006 15:04:05"), durationStr)
 	
 	if _, err := f.WriteString(summaryLine); err != nil {
 		fmt.Printf("ERROR: Failed to write summary to log file: %s\n", err)
 	}
 }
 
-// ArchiveLogs archives all log files into a compressed archive and removes the original files
-// Returns the archive path and any error
-func ArchiveLogs(logFile string) (string, error) {
+// Formats of the log archive
+const (
+	ArchiveZip    = "zip"
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarZst = "tar.zst"
+	ArchiveNone   = "none" // Leave the log files in place
+)
+
+// DefaultArchiveFormat returns the archive format used when none is configured: zip on
+// Windows, tar.gz elsewhere
+func DefaultArchiveFormat() string {
+	if runtime.GOOS == "windows" {
+		return ArchiveZip
+	}
+	return ArchiveTarGz
+}
+
+// ValidateArchiveFormat checks an archive format, empty meaning DefaultArchiveFormat
+func ValidateArchiveFormat(format string) error {
+	switch format {
+	case "", ArchiveZip, ArchiveTarGz, ArchiveTarZst, ArchiveNone:
+		return nil
+	}
+	return fmt.Errorf("invalid archive format %q: use %s, %s, %s or %s", format, ArchiveZip, ArchiveTarGz, ArchiveTarZst, ArchiveNone)
+}
+
+// RemoveArchives deletes the log archives next to logFile. An interrupted run is archived
+// while its raw logs are kept for resuming, and the resumed run archives them all again.
+func RemoveArchives(logFile string) error {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(logFile), "logs-*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZst} {
+			if strings.HasSuffix(path, "."+format) {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to remove log archive: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ArchiveLogs archives all log files into a compressed archive of the given format, empty
+// for DefaultArchiveFormat, and removes the original files unless keepRaw is set.
+// Returns the archive path, empty with ArchiveNone, and any error
+func ArchiveLogs(logFile, format string, keepRaw bool) (string, error) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
 	// Get the directory of the main log file
 	logDir := filepath.Dir(logFile)
+
+	if format == "" {
+		format = DefaultArchiveFormat()
+	}
+	if err := ValidateArchiveFormat(format); err != nil {
+		return "", err
+	}
+	if format == ArchiveNone {
+		fmt.Printf("Log files kept in %s\n", logDir)
+		return "", nil
+	}
 	
 	// Generate timestamp for archive name
 	timestamp := time.Now().Format("20060102-150405")
-	
-	// Define archive filename based on OS
-	var archivePath string
-	isWindows := runtime.GOOS == "windows"
-	
-	if isWindows {
-		archivePath = filepath.Join(logDir, fmt.Sprintf("logs-%s.zip", timestamp))
-	} else {
-		archivePath = filepath.Join(logDir, fmt.Sprintf("logs-%s.tar.gz", timestamp))
-	}
+	archivePath := filepath.Join(logDir, fmt.Sprintf("logs-%s.%s", timestamp, format))
 	
 	// Collect all log files to be archived
 	logFiles := []string{}
@@ -169,21 +237,29 @@ func ArchiveLogs(logFile string) (string, error) {
 		logFiles = append(logFiles, logFile)
 	}
 	
-	// Find all success and error log files in the same directory
-	entries, err := os.ReadDir(logDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to read log directory: %w", err)
+	// Add the result files written next to the main log
+	for _, fileName := range []string{IndexFile, ManifestFile, JournalFile, ReportFile} {
+		if _, err := os.Stat(filepath.Join(logDir, fileName)); err == nil {
+			logFiles = append(logFiles, filepath.Join(logDir, fileName))
+		}
 	}
 	
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	// Add the success and error logs of every directory
+	dirLogs := filepath.Join(logDir, DirLogsDir)
+	err := filepath.WalkDir(dirLogs, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
 		}
-		
-		fileName := entry.Name()
-		if strings.HasSuffix(fileName, "_success.txt") || strings.HasSuffix(fileName, "_error.txt") {
-			logFiles = append(logFiles, filepath.Join(logDir, fileName))
+		if entry.Type().IsRegular() {
+			logFiles = append(logFiles, path)
 		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory logs: %w", err)
 	}
 	
 	// If no log files found, return
@@ -191,22 +267,35 @@ func ArchiveLogs(logFile string) (string, error) {
 		return "", fmt.Errorf("no log files found to archive")
 	}
 	
-	// Create archive based on OS
+	// Create archive in the requested format
 	var archiveErr error
-	if isWindows {
-		archiveErr = createZipArchive(archivePath, logFiles)
-	} else {
-		archiveErr = createTarGzArchive(archivePath, logFiles)
+	switch format {
+	case ArchiveZip:
+		archiveErr = createZipArchive(archivePath, logDir, logFiles)
+	case ArchiveTarGz:
+		archiveErr = createTarArchive(archivePath, logDir, logFiles, func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		})
+	case ArchiveTarZst:
+		archiveErr = createTarArchive(archivePath, logDir, logFiles, func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		})
 	}
 	
 	if archiveErr != nil {
+		os.Remove(archivePath)
 		return "", fmt.Errorf("failed to create archive: %w", archiveErr)
 	}
 	
-	// Delete the original log files
-	for _, file := range logFiles {
-		if err := os.Remove(file); err != nil {
-			fmt.Printf("WARNING: Failed to delete original log file %s: %s\n", file, err)
+	// Delete the original log files, unless they are kept next to the archive
+	if !keepRaw {
+		for _, file := range logFiles {
+			if err := os.Remove(file); err != nil {
+				fmt.Printf("WARNING: Failed to delete original log file %s: %s\n", file, err)
+			}
+		}
+		if err := os.RemoveAll(dirLogs); err != nil {
+			fmt.Printf("WARNING: Failed to delete directory logs %s: %s\n", dirLogs, err)
 		}
 	}
 	
@@ -214,8 +303,8 @@ func ArchiveLogs(logFile string) (string, error) {
 	return archivePath, nil
 }
 
-// createZipArchive creates a zip archive containing the specified files
-func createZipArchive(archivePath string, files []string) error {
+// createZipArchive creates a zip archive containing the specified files, named relative to root
+func createZipArchive(archivePath, root string, files []string) error {
 	zipFile, err := os.Create(archivePath)
 	if err != nil {
 		return fmt.Errorf("failed to create zip file: %w", err)
@@ -226,7 +315,7 @@ func createZipArchive(archivePath string, files []string) error {
 	defer zipWriter.Close()
 	
 	for _, file := range files {
-		if err := addFileToZip(zipWriter, file); err != nil {
+		if err := addFileToZip(zipWriter, root, file); err != nil {
 			return fmt.Errorf("failed to add file to zip: %w", err)
 		}
 	}
@@ -235,7 +324,7 @@ func createZipArchive(archivePath string, files []string) error {
 }
 
 // addFileToZip adds a file to a zip archive
-func addFileToZip(zipWriter *zip.Writer, filePath string) error {
+func addFileToZip(zipWriter *zip.Writer, root, filePath string) error {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to get file info: %w", err)
@@ -246,8 +335,8 @@ func addFileToZip(zipWriter *zip.Writer, filePath string) error {
 		return fmt.Errorf("failed to create file header: %w", err)
 	}
 	
-	// Use just the base filename to avoid directory structure in the archive
-	header.Name = filepath.Base(filePath)
+	// Name the file relative to the log directory, keeping the tree of directory logs
+	header.Name = archiveName(root, filePath)
 	
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
@@ -268,22 +357,26 @@ func addFileToZip(zipWriter *zip.Writer, filePath string) error {
 	return nil
 }
 
-// createTarGzArchive creates a tar.gz archive containing the specified files
-func createTarGzArchive(archivePath string, files []string) error {
+// createTarArchive creates a tar archive containing the specified files, named relative to
+// root and compressed by the writer returned by compress
+func createTarArchive(archivePath, root string, files []string, compress func(io.Writer) (io.WriteCloser, error)) error {
 	tarFile, err := os.Create(archivePath)
 	if err != nil {
 		return fmt.Errorf("failed to create tar file: %w", err)
 	}
 	defer tarFile.Close()
 	
-	gzWriter := gzip.NewWriter(tarFile)
-	defer gzWriter.Close()
+	compressor, err := compress(tarFile)
+	if err != nil {
+		return fmt.Errorf("failed to create compressor: %w", err)
+	}
+	defer compressor.Close()
 	
-	tarWriter := tar.NewWriter(gzWriter)
+	tarWriter := tar.NewWriter(compressor)
 	defer tarWriter.Close()
 	
 	for _, file := range files {
-		if err := addFileToTar(tarWriter, file); err != nil {
+		if err := addFileToTar(tarWriter, root, file); err != nil {
 			return fmt.Errorf("failed to add file to tar: %w", err)
 		}
 	}
@@ -292,7 +385,7 @@ func createTarGzArchive(archivePath string, files []string) error {
 }
 
 // addFileToTar adds a file to a tar archive
-func addFileToTar(tarWriter *tar.Writer, filePath string) error {
+func addFileToTar(tarWriter *tar.Writer, root, filePath string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -309,8 +402,8 @@ func addFileToTar(tarWriter *tar.Writer, filePath string) error {
 		return fmt.Errorf("failed to create tar header: %w", err)
 	}
 	
-	// Use just the base filename to avoid directory structure in the archive
-	header.Name = filepath.Base(filePath)
+	// Name the file relative to the log directory, keeping the tree of directory logs
+	header.Name = archiveName(root, filePath)
 	
 	if err := tarWriter.WriteHeader(header); err != nil {
 		return fmt.Errorf("failed to write tar header: %w", err)
@@ -324,3 +417,12 @@ func addFileToTar(tarWriter *tar.Writer, filePath string) error {
 	return nil
 }
 
+// archiveName returns the name of a file inside an archive: its path relative to root, with
+// forward slashes
+func archiveName(root, filePath string) string {
+	name, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+	return filepath.ToSlash(name)
+}
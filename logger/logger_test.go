@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRunLogs creates the main log, a result file and a directory log of a run in a
+// temporary directory and returns the path of the main log
+func writeRunLogs(t *testing.T) string {
+	t.Helper()
+	logFile := filepath.Join(t.TempDir(), "script.log")
+	if err := InitializeLogFile(logFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(logFile), ManifestFile), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	WriteErrorLog(logFile, "apps/api", "Stderr Output:\nboom")
+	return logFile
+}
+
+func TestArchiveLogs(t *testing.T) {
+	archived := []string{"script.log", ManifestFile, IndexFile, "dirs/apps/api/error.txt"}
+	for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZst} {
+		for _, keepRaw := range []bool{false, true} {
+			logFile := writeRunLogs(t)
+			logDir := filepath.Dir(logFile)
+
+			archive, err := ArchiveLogs(logFile, format, keepRaw)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if filepath.Dir(archive) != logDir || !strings.HasSuffix(archive, "."+format) {
+				t.Errorf("%s: archive %s, want a .%s file in %s", format, archive, format, logDir)
+			}
+			for _, name := range archived {
+				if _, err := ReadArchivedFile(archive, name); err != nil {
+					t.Errorf("%s: %s not archived: %v", format, name, err)
+				}
+				_, err := os.Stat(filepath.Join(logDir, filepath.FromSlash(name)))
+				if kept := err == nil; kept != keepRaw {
+					t.Errorf("%s with keepRaw %t: %s kept: %t", format, keepRaw, name, kept)
+				}
+			}
+			content, err := ReadArchivedFile(archive, "dirs/apps/api/error.txt")
+			if err == nil && !strings.Contains(string(content), "boom") {
+				t.Errorf("%s: archived error log %q lost its content", format, content)
+			}
+		}
+	}
+}
+
+func TestArchiveLogsNone(t *testing.T) {
+	logFile := writeRunLogs(t)
+	archive, err := ArchiveLogs(logFile, ArchiveNone, false)
+	if err != nil || archive != "" {
+		t.Fatalf("got archive %q and error %v, want neither", archive, err)
+	}
+	if _, err := os.Stat(logFile); err != nil {
+		t.Errorf("log file removed without an archive: %v", err)
+	}
+}
+
+func TestValidateArchiveFormat(t *testing.T) {
+	for _, format := range []string{"", ArchiveZip, ArchiveTarGz, ArchiveTarZst, ArchiveNone} {
+		if err := ValidateArchiveFormat(format); err != nil {
+			t.Errorf("%q rejected: %v", format, err)
+		}
+	}
+	for _, format := range []string{"rar", "tar", "tgz", "ZIP"} {
+		if err := ValidateArchiveFormat(format); err == nil {
+			t.Errorf("%q accepted", format)
+		}
+	}
+}
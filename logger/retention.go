@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PruneRuns deletes the log directories of old runs under logDir: all but the keep most
+// recent ones, and those older than maxAge. Zero disables either limit. The run called
+// current is never deleted, nor are runs that were interrupted or are still executing, so
+// that they can be resumed. Returns the deleted directories
+func PruneRuns(logDir string, keep int, maxAge time.Duration, current string) ([]string, error) {
+	if keep <= 0 && maxAge <= 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	type run struct {
+		name     string
+		modified time.Time
+	}
+	var runs []run
+	for _, entry := range entries {
+		dir := filepath.Join(logDir, entry.Name())
+		if !entry.IsDir() || entry.Name() == current || !isRunDir(dir) || !isFinished(dir) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run{name: entry.Name(), modified: info.ModTime()})
+	}
+
+	// Most recent first; the current run counts towards keep
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].modified.Equal(runs[j].modified) {
+			return runs[i].modified.After(runs[j].modified)
+		}
+		return runs[i].name > runs[j].name
+	})
+	kept := keep
+	if current != "" {
+		kept--
+	}
+
+	var pruned []string
+	for i, run := range runs {
+		tooMany := keep > 0 && i >= kept
+		tooOld := maxAge > 0 && time.Since(run.modified) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		path := filepath.Join(logDir, run.name)
+		if err := os.RemoveAll(path); err != nil {
+			return pruned, fmt.Errorf("failed to delete logs of run %s: %w", run.name, err)
+		}
+		pruned = append(pruned, path)
+	}
+	return pruned, nil
+}
+
+// isRunDir reports whether dir holds the logs of a run, so that unrelated directories
+// sharing the log directory are left alone
+func isRunDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ManifestFile || name == JournalFile || name == IndexFile || strings.HasPrefix(name, "logs-") {
+			return true
+		}
+	}
+	return false
+}
+
+// isFinished reports whether the run logged in dir completed. The journal of a run that
+// completed is archived or records the finished event.
+func isFinished(dir string) bool {
+	file, err := os.Open(filepath.Join(dir, JournalFile))
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry struct {
+			Event string `json:"event"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Event == JournalFinished {
+			return true
+		}
+	}
+	return false
+}
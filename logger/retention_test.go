@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeRun creates the log directory of a run under logDir, last modified age ago
+func writeRun(t *testing.T, logDir, name string, age time.Duration) {
+	t.Helper()
+	dir := filepath.Join(logDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "logs-20260101-000000.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(dir, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		keep    int
+		maxAge  time.Duration
+		current string
+		want    []string // Runs deleted
+	}{
+		{name: "no limits", want: nil},
+		{name: "keep count", keep: 2, want: []string{"run-3", "run-4"}},
+		{name: "current run counts towards keep", keep: 2, current: "run-3", want: []string{"run-2", "run-4"}},
+		{name: "current run never deleted", keep: 1, current: "run-4", want: []string{"run-1", "run-2", "run-3"}},
+		{name: "max age", maxAge: 36 * time.Hour, want: []string{"run-3", "run-4"}},
+		{name: "both limits", keep: 3, maxAge: 60 * time.Hour, want: []string{"run-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logDir := t.TempDir()
+			for i, name := range []string{"run-1", "run-2", "run-3", "run-4"} {
+				writeRun(t, logDir, name, time.Duration(i)*24*time.Hour)
+			}
+			// Directories without run logs are not runs
+			if err := os.Mkdir(filepath.Join(logDir, "notes"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(filepath.Join(logDir, "notes"), time.Unix(0, 0), time.Unix(0, 0))
+
+			pruned, err := PruneRuns(logDir, tt.keep, tt.maxAge, tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, path := range pruned {
+				got = append(got, filepath.Base(path))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pruned %q, want %q", got, tt.want)
+			}
+			for _, name := range append(tt.want, "notes") {
+				_, err := os.Stat(filepath.Join(logDir, name))
+				if exists := err == nil; exists != (name == "notes") {
+					t.Errorf("%s exists: %t", name, exists)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneRunsMissingLogDir(t *testing.T) {
+	pruned, err := PruneRuns(filepath.Join(t.TempDir(), "missing"), 1, 0, "")
+	if err != nil || len(pruned) > 0 {
+		t.Errorf("got %q and error %v, want nothing pruned", pruned, err)
+	}
+}
+
+func TestPruneRunsKeepsUnfinishedRuns(t *testing.T) {
+	logDir := t.TempDir()
+	journals := map[string]string{
+		"finished":    `{"event":"run"}` + "\n" + `{"event":"finished"}` + "\n",
+		"interrupted": `{"event":"run"}` + "\n" + `{"event":"done","dir":"a"}` + "\n",
+		"truncated":   `{"event":"run"}` + "\n" + `{"event":"fin`,
+	}
+	for name, journal := range journals {
+		writeRun(t, logDir, name, 48*time.Hour)
+		if err := os.WriteFile(filepath.Join(logDir, name, JournalFile), []byte(journal), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filepath.Join(logDir, name), time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour))
+	}
+
+	pruned, err := PruneRuns(logDir, 0, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || filepath.Base(pruned[0]) != "finished" {
+		t.Errorf("pruned %q, want only the finished run", pruned)
+	}
+}
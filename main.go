@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
-	"sync"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/gustavodamazio/mdir-run/config"
-	"github.com/gustavodamazio/mdir-run/directories"
 	"github.com/gustavodamazio/mdir-run/executor"
 	"github.com/gustavodamazio/mdir-run/gui"
 	"github.com/gustavodamazio/mdir-run/logger"
 	"github.com/gustavodamazio/mdir-run/progress"
-
-	"github.com/gosuri/uilive"
+	"github.com/gustavodamazio/mdir-run/report"
 )
 
 func main() {
@@ -25,26 +28,34 @@ func main() {
 	flag.Parse()
 	
 	// Check if any CLI-specific flags were provided
-	hasCLIFlags := *cliFlag || 
-		*config.DirFlag != "" || 
-		*config.CommandsFlag != "" || 
-		*config.SubDirsFlag != "" || 
-		*config.ConcurrencyFlag != 10 ||  // 10 is the default
-		*config.RetriesFlag != 0       // 0 is the default
+	hasCLIFlags := *cliFlag
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "gui" {
+			hasCLIFlags = true
+		}
+	})
 	
 	// If CLI flags were provided or CLI mode is explicitly requested, use CLI mode
 	if hasCLIFlags || !(*guiFlag) {
-		runCLIMode()
-		return
+		os.Exit(runCLIMode())
 	}
 	
 	// If no CLI flags were provided and GUI is not disabled, launch the GUI
 	gui.LaunchGUI()
 }
 
-func runCLIMode() {
+// runCLIMode runs the job from command line flags and returns the process exit code
+func runCLIMode() int {
 	// Record the start time for the overall execution
 	startTime := time.Now()
+
+	// Cancel the run on Ctrl-C or SIGTERM; a second signal terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 	
 	// Parse configuration
 	cfg, err := config.ParseConfig()
@@ -52,14 +63,18 @@ func runCLIMode() {
 		log.Fatalf("Failed to parse configuration: %v", err)
 	}
 
-	// Initialize the log file
-	err = logger.InitializeLogFile(cfg.LogFile)
+	// Initialize the log file, or continue the one of the interrupted run
+	if cfg.Resume {
+		err = logger.ResumeLogFile(cfg.LogFile)
+	} else {
+		err = logger.InitializeLogFile(cfg.LogFile)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize log file: %v", err)
 	}
 
 	// Get list of directories to process
-	dirs, err := directories.GetDirectories(cfg.InitialDir)
+	dirs, err := cfg.Directories()
 	if err != nil {
 		log.Fatalf("Failed to get directories: %v", err)
 	}
@@ -67,49 +82,123 @@ func runCLIMode() {
 	// Initialize progress manager
 	progressManager := progress.NewProgressManager(dirs)
 
-	// Initialize the writer
-	writer := uilive.New()
-	writer.Start()
-	defer writer.Stop()
+	// Journal every finished step, so that an interrupted run can be resumed
+	journal, err := openJournal(cfg, dirs, progressManager)
+	if err != nil {
+		log.Fatalf("Failed to open journal: %v", err)
+	}
+	if cfg.Journal != nil {
+		startTime = cfg.Journal.Started
+	}
 
-	// Limit concurrency
-	semaphore := make(chan struct{}, cfg.Concurrency)
-	var wg sync.WaitGroup
+	// Show JSON events, the live output of every command, or the compact progress view
+	var events *progress.Events
+	var view *progress.View
+	switch {
+	case cfg.Output == config.OutputJSON:
+		// Standard output only carries events; anything else printed goes to standard error
+		events = progress.NewEvents(os.Stdout)
+		os.Stdout = os.Stderr
+		events.RunStarted(cfg.RunID, filepath.Dir(cfg.LogFile), cfg.InitialDir, dirs, cfg.CommandLines(), cfg.Concurrency)
+		progressManager.AddReporter(events)
+	case cfg.Stream:
+		progressManager.AddReporter(progress.NewStream(os.Stdout, dirs, progress.ColorEnabled(os.Stdout)))
+	default:
+		view = progress.NewView(progressManager.Results())
+		progressManager.AddReporter(view)
+		view.Start()
+	}
 
 	// Process directories
-	for _, dir := range dirs {
-		wg.Add(1)
-		go func(dir string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-			executor.ProcessRepo(dir, cfg, progressManager)
-		}(dir)
+	execErr := executor.ExecuteCommands(ctx, dirs, cfg, progressManager, nil)
+	if view != nil {
+		view.Stop()
 	}
-
-	// Start display updater
-	done := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			default:
-				progressManager.PrintAllProgress(writer)
-				time.Sleep(100 * time.Millisecond)
-			}
+	if execErr != nil {
+		log.Printf("Run stopped early: %v", execErr)
+	}
+	if ctx.Err() == nil {
+		journal.Finish()
+	}
+	journal.Close()
+	manifest := progressManager.Manifest(cfg.InitialDir, startTime)
+	manifest.RunID = cfg.RunID
+	if err := progress.WriteManifest(cfg.LogFile, manifest); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if events != nil {
+		events.RunFinished(manifest, ctx.Err() != nil)
+	}
+	if cfg.HTMLReport {
+		if err := report.WriteHTML(filepath.Join(filepath.Dir(cfg.LogFile), logger.ReportFile), manifest, progressManager.Results()); err != nil {
+			log.Printf("WARNING: %v", err)
 		}
-	}()
+	}
+	if cfg.MarkdownSummary != "" {
+		if err := report.WriteMarkdown(cfg.MarkdownSummary, manifest, progressManager.Results()); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
+	if cfg.JUnit != "" {
+		if err := report.WriteJUnit(cfg.JUnit, progressManager.Results(), time.Since(startTime)); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
 
-	wg.Wait()
-	close(done)
-	progressManager.PrintAllProgress(writer)
-	
 	// Write the final summary to the log file with execution time
-	logger.WriteSummaryLog(cfg.LogFile, startTime)
+	interrupted := ctx.Err() != nil
+	logger.WriteSummaryLog(cfg.LogFile, startTime, interrupted)
 	
-	// Archive log files and remove originals
-	if _, err := logger.ArchiveLogs(cfg.LogFile); err != nil {
+	// Archive log files and remove originals; an interrupted run keeps them so that -resume
+	// can continue it
+	if _, err := logger.ArchiveLogs(cfg.LogFile, cfg.ArchiveFormat, cfg.KeepRawLogs || interrupted); err != nil {
 		log.Printf("WARNING: Failed to archive log files: %v", err)
 	}
+
+	// Delete the logs of old runs beyond the retention policy
+	if pruned, err := cfg.PruneRuns(); err != nil {
+		log.Printf("WARNING: Failed to delete old logs: %v", err)
+	} else if len(pruned) > 0 {
+		log.Printf("Deleted the logs of %d old runs", len(pruned))
+	}
+
+	if interrupted {
+		log.Printf("Run %s interrupted, continue it with -resume -dir %s", cfg.RunID, cfg.InitialDir)
+		return 130 // Conventional exit code for a run interrupted by a signal
+	}
+	if errors.Is(execErr, executor.ErrFailureLimit) {
+		return 1
+	}
+	return 0
+}
+
+// openJournal starts the journal of a new run, or for a resumed run restores the directories
+// it finished and continues its journal. Logs of directories that run again, and the archive
+// of the interrupted run, are removed.
+func openJournal(cfg *config.Config, dirs []string, progressManager *progress.ProgressManager) (*progress.Journal, error) {
+	if cfg.Journal == nil {
+		journal, err := progress.CreateJournal(cfg.LogFile, cfg.JournalRun(dirs))
+		if err != nil {
+			return nil, err
+		}
+		progressManager.SetJournal(journal)
+		return journal, nil
+	}
+
+	// The archive of the interrupted run is replaced by the one of the combined run
+	if err := logger.RemoveArchives(cfg.LogFile); err != nil {
+		return nil, err
+	}
+	cfg.Journal.Restore(progressManager)
+	for _, dir := range dirs {
+		if !progressManager.Finished(dir) {
+			logger.RemoveDirLogs(cfg.LogFile, dir)
+		}
+	}
+	journal, err := progress.ResumeJournal(cfg.LogFile)
+	if err != nil {
+		return nil, err
+	}
+	progressManager.SetJournal(journal)
+	return journal, nil
 }
@@ -0,0 +1,205 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventsVersion is the schema version of the JSON event stream, present in every event
+const EventsVersion = 1
+
+// Event types of the JSON event stream
+const (
+	EventRunStarted   = "run_started"
+	EventDirStarted   = "dir_started"
+	EventStepStarted  = "step_started"
+	EventStepOutput   = "step_output"
+	EventStepFinished = "step_finished"
+	EventDirFinished  = "dir_finished"
+	EventRunFinished  = "run_finished"
+)
+
+// eventHeader starts every event
+type eventHeader struct {
+	Version int       `json:"version"`
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+}
+
+type runStartedEvent struct {
+	eventHeader
+	RunID       string   `json:"run_id"`
+	LogDir      string   `json:"log_dir"`
+	Dir         string   `json:"dir"`
+	Dirs        []string `json:"dirs"`
+	Commands    []string `json:"commands"`
+	Concurrency int      `json:"concurrency"`
+}
+
+type dirStartedEvent struct {
+	eventHeader
+	Dir string `json:"dir"`
+}
+
+type stepStartedEvent struct {
+	eventHeader
+	Dir     string `json:"dir"`
+	Step    int    `json:"step"`
+	Steps   int    `json:"steps"`
+	Command string `json:"command"`
+}
+
+type stepOutputEvent struct {
+	eventHeader
+	Dir     string `json:"dir"`
+	Step    int    `json:"step"`
+	Attempt int    `json:"attempt"`
+	Stream  string `json:"stream"` // "stdout" or "stderr"
+	Line    string `json:"line"`
+}
+
+type stepFinishedEvent struct {
+	eventHeader
+	Dir            string  `json:"dir"`
+	Step           int     `json:"step"`
+	Command        string  `json:"command"`
+	Result         string  `json:"result"`
+	Status         string  `json:"status"`
+	Error          string  `json:"error,omitempty"`
+	StopsDirectory bool    `json:"stops_directory"`
+	ExitCode       int     `json:"exit_code"`
+	Attempts       int     `json:"attempts"`
+	MaxAttempts    int     `json:"max_attempts"`
+	Seconds        float64 `json:"seconds"`
+}
+
+type dirFinishedEvent struct {
+	eventHeader
+	DirResult
+}
+
+type runFinishedEvent struct {
+	eventHeader
+	Dir         string         `json:"dir"`
+	Seconds     float64        `json:"seconds"`
+	Interrupted bool           `json:"interrupted"`
+	Results     map[string]int `json:"results"` // Number of directories per result
+}
+
+// Events renders a run as newline-delimited JSON events, one per line
+type Events struct {
+	mu       sync.Mutex
+	encoder  *json.Encoder
+	started  map[string]bool // Directories whose dir_started event was written
+	lastStep map[string]int  // Last step_started event of each directory
+	attempt  map[string]int  // Attempt of the step running in each directory
+	finished map[string]bool // Directories whose dir_finished event was written
+}
+
+// NewEvents creates an Events reporter writing to out
+func NewEvents(out io.Writer) *Events {
+	return &Events{
+		encoder:  json.NewEncoder(out),
+		started:  make(map[string]bool),
+		lastStep: make(map[string]int),
+		attempt:  make(map[string]int),
+		finished: make(map[string]bool),
+	}
+}
+
+// header returns the start of a new event
+func header(event string) eventHeader {
+	return eventHeader{Version: EventsVersion, Event: event, Time: time.Now()}
+}
+
+// write encodes an event on its own line
+func (e *Events) write(event any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.encoder.Encode(event)
+}
+
+// RunStarted writes the run_started event of the run runID, logging to logDir
+func (e *Events) RunStarted(runID, logDir, dir string, dirs, commands []string, concurrency int) {
+	e.write(runStartedEvent{
+		eventHeader: header(EventRunStarted),
+		RunID:       runID,
+		LogDir:      logDir,
+		Dir:         dir,
+		Dirs:        dirs,
+		Commands:    commands,
+		Concurrency: concurrency,
+	})
+}
+
+// RunFinished writes the run_finished event, counting the results of the manifest
+func (e *Events) RunFinished(manifest *Manifest, interrupted bool) {
+	results := make(map[string]int)
+	for _, result := range manifest.Directories {
+		results[result.Result]++
+	}
+	e.write(runFinishedEvent{
+		eventHeader: header(EventRunFinished),
+		Dir:         manifest.Dir,
+		Seconds:     manifest.Finished.Sub(manifest.Started).Seconds(),
+		Interrupted: interrupted,
+		Results:     results,
+	})
+}
+
+// Update writes dir_started, step_started and dir_finished events as the directory progresses
+func (e *Events) Update(progress *Progress) {
+	e.mu.Lock()
+	start := !progress.Started.IsZero() && !e.started[progress.Dir]
+	step := progress.Status == StatusProcessing && progress.Step > 0 && e.lastStep[progress.Dir] != progress.Step
+	finish := progress.Status != StatusProcessing && !e.finished[progress.Dir]
+	e.started[progress.Dir] = e.started[progress.Dir] || start
+	e.lastStep[progress.Dir] = progress.Step
+	e.attempt[progress.Dir] = progress.Attempt
+	e.finished[progress.Dir] = e.finished[progress.Dir] || finish
+	e.mu.Unlock()
+
+	if start {
+		e.write(dirStartedEvent{eventHeader: header(EventDirStarted), Dir: progress.Dir})
+	}
+	if step {
+		e.write(stepStartedEvent{eventHeader: header(EventStepStarted), Dir: progress.Dir, Step: progress.Step, Steps: progress.Total, Command: progress.Command})
+	}
+	if finish {
+		e.write(dirFinishedEvent{eventHeader: header(EventDirFinished), DirResult: *dirResult(progress)})
+	}
+}
+
+// StepOutput returns the writers turning every line of a step output into a step_output event,
+// carrying the attempt that printed it
+func (e *Events) StepOutput(dir string, step int) (stdout, stderr *LineWriter) {
+	output := func(stream string) *LineWriter {
+		return NewLineWriter(func(line string) {
+			e.mu.Lock()
+			attempt := max(e.attempt[dir], 1)
+			e.mu.Unlock()
+			e.write(stepOutputEvent{eventHeader: header(EventStepOutput), Dir: dir, Step: step, Attempt: attempt, Stream: stream, Line: line})
+		})
+	}
+	return output("stdout"), output("stderr")
+}
+
+// StepFinished writes the step_finished event
+func (e *Events) StepFinished(dir string, result StepResult) {
+	e.write(stepFinishedEvent{
+		eventHeader:    header(EventStepFinished),
+		Dir:            dir,
+		Step:           result.Step,
+		Command:        result.Command,
+		Result:         Result(result.Status),
+		Status:         result.Status,
+		Error:          result.Error,
+		StopsDirectory: result.StopsDirectory,
+		ExitCode:       result.ExitCode,
+		Attempts:       result.Attempts,
+		MaxAttempts:    result.MaxAttempts,
+		Seconds:        result.Duration.Seconds(),
+	})
+}
@@ -0,0 +1,52 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEventsStepOutputAttempt(t *testing.T) {
+	var out bytes.Buffer
+	events := NewEvents(&out)
+	pm := NewProgressManager([]string{"api"})
+	pm.AddReporter(events)
+
+	running := &Progress{Dir: "api", Status: StatusProcessing, Started: time.Now(), Step: 1, Total: 1, Command: "make", Attempt: 1}
+	pm.UpdateProgress("api", running)
+	stdout, stderr := pm.StepOutput("api", 1)
+	stdout.Write([]byte("building\n"))
+	stderr.Write([]byte("connection reset\n"))
+	running.Attempt = 2
+	pm.UpdateProgress("api", running)
+	stdout.Write([]byte("built\n"))
+
+	type outputEvent struct {
+		Event   string `json:"event"`
+		Step    int    `json:"step"`
+		Attempt int    `json:"attempt"`
+		Stream  string `json:"stream"`
+		Line    string `json:"line"`
+	}
+	var got []outputEvent
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var event outputEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event == EventStepOutput {
+			got = append(got, event)
+		}
+	}
+	want := []outputEvent{
+		{EventStepOutput, 1, 1, "stdout", "building"},
+		{EventStepOutput, 1, 1, "stderr", "connection reset"},
+		{EventStepOutput, 1, 2, "stdout", "built"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got step_output events %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,230 @@
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/logger"
+)
+
+// Journal events
+const (
+	journalRun      = "run"                  // A run started, with its directories and commands
+	journalResume   = "resume"               // The run was resumed
+	journalStep     = "step"                 // A step of a directory finished
+	journalDone     = "done"                 // A directory reached its final status
+	journalFinished = logger.JournalFinished // The run completed, so there is nothing left to resume
+)
+
+// journalEntry is a single line of the journal
+type journalEntry struct {
+	Event    string     `json:"event"`
+	Time     time.Time  `json:"time"`
+	Dir      string     `json:"dir,omitempty"`
+	Dirs     []string   `json:"dirs,omitempty"`
+	Commands []string   `json:"commands,omitempty"`
+	Shell    bool       `json:"shell,omitempty"`    // The commands ran through a shell
+	Projects bool       `json:"projects,omitempty"` // Some commands came from project definitions
+	Step     int        `json:"step,omitempty"`
+	Failed   bool       `json:"failed,omitempty"` // The step failed the directory
+	Result   *DirResult `json:"result,omitempty"`
+}
+
+// Journal appends the progress of a run to a file as it happens, so that an
+// interrupted run can be resumed
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// journalPath returns the journal location next to logFile
+func journalPath(logFile string) string {
+	return filepath.Join(filepath.Dir(logFile), logger.JournalFile)
+}
+
+// JournalRun describes the run a journal is created for, so that -resume can repeat it
+type JournalRun struct {
+	Dir      string   // Directory the run processes
+	Dirs     []string // Directories to process
+	Commands []string // Command lines, project commands prefixed with the project name
+	Shell    bool     // The commands run through a shell
+	Projects bool     // Some commands come from project definitions
+}
+
+// CreateJournal starts a new journal next to logFile for run
+func CreateJournal(logFile string, run JournalRun) (*Journal, error) {
+	file, err := os.Create(journalPath(logFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	j := &Journal{file: file}
+	j.write(journalEntry{
+		Event:    journalRun,
+		Dir:      run.Dir,
+		Dirs:     run.Dirs,
+		Commands: run.Commands,
+		Shell:    run.Shell,
+		Projects: run.Projects,
+	})
+	return j, nil
+}
+
+// ResumeJournal reopens the journal next to logFile to continue appending to it
+func ResumeJournal(logFile string) (*Journal, error) {
+	file, err := os.OpenFile(journalPath(logFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j := &Journal{file: file}
+	j.write(journalEntry{Event: journalResume})
+	return j, nil
+}
+
+// Finish records that the run completed, so that it is not mistaken for an interrupted run
+// while its journal is kept with the raw logs
+func (j *Journal) Finish() {
+	j.write(journalEntry{Event: journalFinished})
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// write appends an entry and syncs it to disk, so it survives a crash or power loss
+func (j *Journal) write(entry journalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		fmt.Printf("WARNING: Failed to write to journal: %s\n", err)
+		return
+	}
+	j.file.Sync()
+}
+
+// JournalState is what an interrupted run had completed
+type JournalState struct {
+	JournalRun
+	Started  time.Time
+	Finished bool                 // The run completed, there is nothing to resume
+	Done     map[string]DirResult // Directories that reached a final status
+	Steps    map[string]int       // Last finished step of directories still in progress
+	Failed   map[string]bool      // Directories in progress where a step failed the directory
+}
+
+// LoadJournal reads the journal next to logFile. A truncated last line, left by
+// an interrupted write, is ignored.
+func LoadJournal(logFile string) (*JournalState, error) {
+	file, err := os.Open(journalPath(logFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no interrupted run to resume in %s", filepath.Dir(logFile))
+		}
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer file.Close()
+
+	state := &JournalState{
+		Done:   make(map[string]DirResult),
+		Steps:  make(map[string]int),
+		Failed: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		switch entry.Event {
+		case journalRun:
+			state.JournalRun = JournalRun{
+				Dir:      entry.Dir,
+				Dirs:     entry.Dirs,
+				Commands: entry.Commands,
+				Shell:    entry.Shell,
+				Projects: entry.Projects,
+			}
+			state.Started = entry.Time
+		case journalStep:
+			state.Steps[entry.Dir] = max(state.Steps[entry.Dir], entry.Step)
+			state.Failed[entry.Dir] = state.Failed[entry.Dir] || entry.Failed
+		case journalDone:
+			if entry.Result != nil {
+				state.Done[entry.Dir] = *entry.Result
+			}
+		case journalFinished:
+			state.Finished = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	if state.Dirs == nil {
+		return nil, fmt.Errorf("journal in %s does not describe a run", filepath.Dir(logFile))
+	}
+	return state, nil
+}
+
+// Check reports whether the journal belongs to a run over initialDir with the same commands,
+// run through a shell or not
+func (s *JournalState) Check(initialDir string, commands []string, shell bool) error {
+	if s.Dir != initialDir {
+		return fmt.Errorf("the interrupted run processed %s, not %s", s.Dir, initialDir)
+	}
+	if !slices.Equal(s.Commands, commands) {
+		return fmt.Errorf("the commands differ from the interrupted run (%q)", s.Commands)
+	}
+	if s.Shell != shell {
+		return fmt.Errorf("the interrupted run used -shell=%t", s.Shell)
+	}
+	return nil
+}
+
+// StartSteps maps every directory in progress to the step after its last finished one.
+// Directories where a step failed the directory, or all of them with restart, start over.
+func (s *JournalState) StartSteps(restart bool) map[string]int {
+	steps := make(map[string]int)
+	for dir, step := range s.Steps {
+		if _, done := s.Done[dir]; done || restart || s.Failed[dir] {
+			continue
+		}
+		steps[dir] = step + 1
+	}
+	return steps
+}
+
+// Restore marks the directories that finished before the interruption with their final status
+func (s *JournalState) Restore(pm *ProgressManager) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for dir, result := range s.Done {
+		progress, ok := pm.progressMap[dir]
+		if !ok {
+			continue
+		}
+		progress.Status = result.Status
+		progress.Command = result.Message
+		progress.Total = result.Steps
+		progress.FailedStep = result.FailedStep
+		progress.FailedSteps = result.FailedSteps
+		progress.SkippedSteps = result.SkippedSteps
+		progress.Duration = time.Duration(result.Seconds * float64(time.Second))
+		pm.journaled[dir] = true
+	}
+}
@@ -0,0 +1,113 @@
+package progress
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// interruptedJournal journals a run over a to f that was interrupted after a succeeded, b
+// finished its first step, the first step of c failed the directory, d was cancelled, e was
+// skipped before it started and f was skipped for lack of a matching project type.
+// The journal ends with a truncated line, as left by a crash during a write.
+func interruptedJournal(t *testing.T) string {
+	t.Helper()
+	logFile := filepath.Join(t.TempDir(), "script.log")
+	journal, err := CreateJournal(logFile, JournalRun{
+		Dir:      "/srv/services",
+		Dirs:     []string{"a", "b", "c", "d", "e", "f"},
+		Commands: []string{"make", "make test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := NewProgressManager([]string{"a", "b", "c", "d", "e", "f"})
+	pm.SetJournal(journal)
+
+	pm.StepFinished("a", StepResult{Step: 1, Status: "SUCCESS(1/1)"})
+	pm.StepFinished("a", StepResult{Step: 2, Status: "SUCCESS(1/1)"})
+	pm.UpdateProgress("a", &Progress{Dir: "a", Status: "SUCCESS(2/2)", Total: 2, Command: "Completed"})
+	pm.StepFinished("b", StepResult{Step: 1, Status: "SUCCESS(1/1)"})
+	pm.StepFinished("c", StepResult{Step: 1, Status: "FAIL(1/1)", StopsDirectory: true})
+	pm.StepFinished("d", StepResult{Step: 1, Status: StatusCancelled})
+	pm.UpdateProgress("d", &Progress{Dir: "d", Status: StatusCancelled})
+	pm.UpdateProgress("e", &Progress{Dir: "e", Status: StatusSkipped, Command: "Not started, failure limit reached"})
+	pm.UpdateProgress("f", &Progress{Dir: "f", Status: StatusSkipped, Command: "No matching project type", Started: time.Now()})
+	journal.Close()
+
+	file, err := os.OpenFile(journalPath(logFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"event":"done","dir":"b","res`)
+	file.Close()
+	return logFile
+}
+
+func TestLoadJournal(t *testing.T) {
+	state, err := LoadJournal(interruptedJournal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Finished {
+		t.Error("interrupted run loaded as finished")
+	}
+	if state.Dir != "/srv/services" || !slices.Equal(state.Dirs, []string{"a", "b", "c", "d", "e", "f"}) {
+		t.Errorf("loaded run of %s over %q", state.Dir, state.Dirs)
+	}
+	if done := slices.Sorted(maps.Keys(state.Done)); !slices.Equal(done, []string{"a", "f"}) {
+		t.Errorf("done directories %q, want a and f", done)
+	}
+
+	tests := []struct {
+		restart bool
+		want    map[string]int
+	}{
+		{restart: false, want: map[string]int{"b": 2}},
+		{restart: true, want: map[string]int{}},
+	}
+	for _, tt := range tests {
+		if got := state.StartSteps(tt.restart); !maps.Equal(got, tt.want) {
+			t.Errorf("StartSteps(%t) = %v, want %v", tt.restart, got, tt.want)
+		}
+	}
+}
+
+func TestJournalRestore(t *testing.T) {
+	state, err := LoadJournal(interruptedJournal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := NewProgressManager(state.Dirs)
+	state.Restore(pm)
+
+	for _, dir := range state.Dirs {
+		if finished := pm.Finished(dir); finished != (dir == "a" || dir == "f") {
+			t.Errorf("%s restored as finished: %t", dir, finished)
+		}
+	}
+	if restored := pm.GetProgress("a"); restored.Status != "SUCCESS(2/2)" || restored.Total != 2 {
+		t.Errorf("a restored with status %s of %d steps", restored.Status, restored.Total)
+	}
+}
+
+func TestJournalFinish(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "script.log")
+	journal, err := CreateJournal(logFile, JournalRun{Dir: "/srv/services", Dirs: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Finish()
+	journal.Close()
+
+	state, err := LoadJournal(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Finished {
+		t.Error("finished run loaded as interrupted")
+	}
+}
@@ -0,0 +1,150 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/logger"
+)
+
+// ManifestVersion is the schema version of the result manifest
+const ManifestVersion = 1
+
+// Results of a directory in the manifest, derived from its final status
+const (
+	ResultSuccess     = "success"
+	ResultFailed      = "failed"
+	ResultTimeout     = "timeout"
+	ResultCancelled   = "cancelled"
+	ResultSkipped     = "skipped"
+	ResultUnprocessed = "unprocessed"
+)
+
+// Manifest is the machine-readable outcome of a run
+type Manifest struct {
+	Version     int         `json:"version"`
+	RunID       string      `json:"run_id,omitempty"`
+	Dir         string      `json:"dir"`
+	Started     time.Time   `json:"started"`
+	Finished    time.Time   `json:"finished"`
+	Directories []DirResult `json:"directories"`
+}
+
+// DirResult is the outcome of a single directory
+type DirResult struct {
+	Dir          string  `json:"dir"`
+	Result       string  `json:"result"`
+	Status       string  `json:"status"`
+	Message      string  `json:"message,omitempty"`
+	Steps        int     `json:"steps,omitempty"`
+	FailedStep   int     `json:"failed_step,omitempty"`
+	FailedSteps  []int   `json:"failed_steps,omitempty"`
+	SkippedSteps []int   `json:"skipped_steps,omitempty"`
+	Seconds      float64 `json:"seconds"`
+}
+
+// Result classifies a final status as one of the Result constants
+func Result(status string) string {
+	switch {
+	case strings.HasPrefix(status, StatusSuccess):
+		return ResultSuccess
+	case strings.HasPrefix(status, StatusFail):
+		return ResultFailed
+	case strings.HasPrefix(status, StatusTimeout):
+		return ResultTimeout
+	case strings.HasPrefix(status, StatusCancelled):
+		return ResultCancelled
+	case strings.HasPrefix(status, StatusSkipped):
+		return ResultSkipped
+	}
+	return ResultUnprocessed
+}
+
+// Manifest captures the current state of every directory, in processing order
+func (pm *ProgressManager) Manifest(dir string, started time.Time) *Manifest {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	manifest := &Manifest{Version: ManifestVersion, Dir: dir, Started: started, Finished: time.Now()}
+	for _, name := range pm.progressOrder {
+		manifest.Directories = append(manifest.Directories, *dirResult(pm.progressMap[name]))
+	}
+	return manifest
+}
+
+// dirResult describes the current state of a directory
+func dirResult(progress *Progress) *DirResult {
+	return &DirResult{
+		Dir:          progress.Dir,
+		Result:       Result(progress.Status),
+		Status:       progress.Status,
+		Message:      progress.Command,
+		Steps:        progress.Total,
+		FailedStep:   progress.FailedStep,
+		FailedSteps:  progress.FailedSteps,
+		SkippedSteps: progress.SkippedSteps,
+		Seconds:      progress.Duration.Seconds(),
+	}
+}
+
+// Unfinished returns the directories that did not succeed, in their original order
+func (m *Manifest) Unfinished() []string {
+	var dirs []string
+	for _, result := range m.Directories {
+		if result.Result != ResultSuccess {
+			dirs = append(dirs, result.Dir)
+		}
+	}
+	return dirs
+}
+
+// FailedSteps maps each directory that failed at a known step to that step
+func (m *Manifest) FailedSteps() map[string]int {
+	steps := make(map[string]int)
+	for _, result := range m.Directories {
+		if result.Result != ResultSuccess && result.FailedStep > 0 {
+			steps[result.Dir] = result.FailedStep
+		}
+	}
+	return steps
+}
+
+// WriteManifest writes the manifest as indented JSON next to logFile
+func WriteManifest(logFile string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result manifest: %w", err)
+	}
+	path := filepath.Join(filepath.Dir(logFile), logger.ManifestFile)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write result manifest: %w", err)
+	}
+	return nil
+}
+
+// LoadManifest reads a result manifest, either directly or from a log archive
+func LoadManifest(path string) (*Manifest, error) {
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".json") {
+		data, err = os.ReadFile(path)
+	} else {
+		data, err = logger.ReadArchivedFile(path, logger.ManifestFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: invalid result manifest: %w", path, err)
+	}
+	if manifest.Version < 1 || manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported result manifest version %d", path, manifest.Version)
+	}
+	return &manifest, nil
+}
@@ -1,12 +1,27 @@
 package progress
 
 import (
-	"fmt"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
 
-	"github.com/gosuri/uilive"
+// Directory statuses. Finished directories may carry an attempt suffix such as SUCCESS(1/3).
+const (
+	StatusProcessing = "Processing"
+	StatusSuccess    = "SUCCESS"
+	StatusFail       = "FAIL"
+	StatusCancelled  = "CANCELLED"
+	StatusTimeout    = "TIMEOUT"
+	StatusSkipped    = "SKIPPED"
 )
 
+// IsFailure reports whether a final status counts as a failed directory
+func IsFailure(status string) bool {
+	return strings.HasPrefix(status, StatusFail) || strings.HasPrefix(status, StatusTimeout)
+}
+
 type Progress struct {
 	Dir      string
 	Step     int
@@ -15,18 +30,81 @@ type Progress struct {
 	Status   string
 	Output   string
 	StartRow int
+
+	FailedSteps  []int         // Step numbers (1-indexed) that failed, including continue_on_error steps
+	SkippedSteps []int         // Step numbers (1-indexed) that did not run because of an earlier failure
+	FailedStep   int           // Step that failed the directory, 0 when none did
+	Started      time.Time     // When processing of the directory started, zero until then
+	Duration     time.Duration // Time spent on the directory once finished
+	Steps        []StepResult  // Steps that ran, in order
+	Commands     []string      // Command lines of every step, once known
+	Attempt      int           // Attempt of the current step, 1-indexed, while it runs
+}
+
+// StepResult is the outcome of a step that ran
+type StepResult struct {
+	Step           int    // Step number, 1-indexed
+	Command        string // Command line of the step
+	Status         string // SUCCESS, FAIL or TIMEOUT with the attempt count, or CANCELLED
+	Error          string // Why the step failed, empty on success
+	StopsDirectory bool   // The failure stopped the directory, as opposed to continue_on_error
+	ExitCode       int    // Exit code of the last attempt, -1 when the command did not exit
+	Attempts       int
+	MaxAttempts    int
+	Started        time.Time
+	Duration       time.Duration
+	Stdout         string
+	Stderr         string
+}
+
+// StepSummary describes the failed and skipped steps, e.g. "failed steps: 2 | skipped steps: 3, 4".
+// It is empty when every step ran successfully.
+func (p *Progress) StepSummary() string {
+	var parts []string
+	if len(p.FailedSteps) > 0 {
+		parts = append(parts, "failed steps: "+joinSteps(p.FailedSteps))
+	}
+	if len(p.SkippedSteps) > 0 {
+		parts = append(parts, "skipped steps: "+joinSteps(p.SkippedSteps))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func joinSteps(steps []int) string {
+	numbers := make([]string, len(steps))
+	for i, step := range steps {
+		numbers[i] = strconv.Itoa(step)
+	}
+	return strings.Join(numbers, ", ")
 }
 
 type ProgressManager struct {
 	mu            sync.Mutex
 	progressMap   map[string]*Progress
 	progressOrder []string
+
+	journal   *Journal        // Records finished steps and directories, when set
+	journaled map[string]bool // Directories whose final status is in the journal
+	reporters []Reporter      // Observe status changes and step output as they happen
+}
+
+// Reporter observes a run as the executor processes it, e.g. to render it in the terminal,
+// as JSON events or in the GUI. Its methods are called from the goroutines processing
+// directories, and Update with the progress manager locked: it must not call back into it.
+type Reporter interface {
+	// Update is called whenever a directory starts, starts a step or changes status
+	Update(progress *Progress)
+	// StepOutput returns the writers receiving the stdout and stderr of a step, nil to ignore them
+	StepOutput(dir string, step int) (stdout, stderr *LineWriter)
+	// StepFinished is called once a step ran
+	StepFinished(dir string, result StepResult)
 }
 
 func NewProgressManager(dirs []string) *ProgressManager {
 	pm := &ProgressManager{
 		progressMap:   make(map[string]*Progress),
 		progressOrder: make([]string, 0, len(dirs)),
+		journaled:     make(map[string]bool),
 	}
 
 	for _, dir := range dirs {
@@ -35,7 +113,7 @@ func NewProgressManager(dirs []string) *ProgressManager {
 			Step:     0,
 			Total:    0,
 			Command:  "Initializing",
-			Status:   "Processing",
+			Status:   StatusProcessing,
 			Output:   "",
 			StartRow: len(pm.progressOrder) + 1,
 		}
@@ -48,6 +126,72 @@ func (pm *ProgressManager) UpdateProgress(dir string, progress *Progress) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 	pm.progressMap[dir] = progress
+	for _, reporter := range pm.reporters {
+		reporter.Update(progress)
+	}
+	// Cancelled directories, and skipped ones that never started, are left unfinished so
+	// that a resumed run processes them
+	notStarted := progress.Status == StatusSkipped && progress.Started.IsZero()
+	if pm.journal != nil && progress.Status != StatusProcessing && progress.Status != StatusCancelled && !notStarted && !pm.journaled[dir] {
+		pm.journaled[dir] = true
+		pm.journal.write(journalEntry{Event: journalDone, Dir: dir, Result: dirResult(progress)})
+	}
+}
+
+// SetJournal records finished steps and directories in journal from now on
+func (pm *ProgressManager) SetJournal(journal *Journal) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.journal = journal
+}
+
+// AddReporter passes every status change and the output of every step to reporter from now on
+func (pm *ProgressManager) AddReporter(reporter Reporter) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.reporters = append(pm.reporters, reporter)
+}
+
+// StepOutput returns the writers passing the live stdout and stderr of a step of dir to every
+// reporter, nil when no reporter wants them
+func (pm *ProgressManager) StepOutput(dir string, step int) (stdout, stderr *LineWriter) {
+	pm.mu.Lock()
+	reporters := pm.reporters
+	pm.mu.Unlock()
+
+	var stdouts, stderrs []*LineWriter
+	for _, reporter := range reporters {
+		stdout, stderr := reporter.StepOutput(dir, step)
+		stdouts = append(stdouts, stdout)
+		stderrs = append(stderrs, stderr)
+	}
+	return teeLines(stdouts), teeLines(stderrs)
+}
+
+// StepFinished adds the result of a step to the progress of dir. Unless the run was
+// cancelled during the step, it is recorded in the journal.
+func (pm *ProgressManager) StepFinished(dir string, result StepResult) {
+	pm.mu.Lock()
+	if progress, ok := pm.progressMap[dir]; ok {
+		progress.Steps = append(progress.Steps, result)
+	}
+	journal, reporters := pm.journal, pm.reporters
+	pm.mu.Unlock()
+
+	if journal != nil && result.Status != StatusCancelled {
+		journal.write(journalEntry{Event: journalStep, Dir: dir, Step: result.Step, Failed: result.StopsDirectory})
+	}
+	for _, reporter := range reporters {
+		reporter.StepFinished(dir, result)
+	}
+}
+
+// Finished reports whether dir already has a final status
+func (pm *ProgressManager) Finished(dir string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	progress, ok := pm.progressMap[dir]
+	return ok && progress.Status != StatusProcessing
 }
 
 func (pm *ProgressManager) GetProgress(dir string) *Progress {
@@ -56,23 +200,14 @@ func (pm *ProgressManager) GetProgress(dir string) *Progress {
 	return pm.progressMap[dir]
 }
 
-func (pm *ProgressManager) PrintAllProgress(writer *uilive.Writer) {
+// Results returns a copy of the progress of every directory, in processing order
+func (pm *ProgressManager) Results() []Progress {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	results := make([]Progress, 0, len(pm.progressOrder))
 	for _, dir := range pm.progressOrder {
-		progress := pm.progressMap[dir]
-		if progress.Status == "Processing" {
-			if progress.Total > 0 {
-				fmt.Fprintf(writer, "%s | step: %d/%d | command: %s\n", progress.Dir, progress.Step, progress.Total, progress.Command)
-			} else {
-				fmt.Fprintf(writer, "%s | %s\n", progress.Dir, progress.Command)
-			}
-		} else if progress.Status == "FAIL" {
-			fmt.Fprintf(writer, "%s | ERROR: %s\n%s\n", progress.Dir, progress.Command, progress.Output)
-		} else {
-			fmt.Fprintf(writer, "%s | %s\n", progress.Dir, progress.Status)
-		}
+		results = append(results, *pm.progressMap[dir])
 	}
-	writer.Flush()
+	return results
 }
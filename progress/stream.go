@@ -0,0 +1,176 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxLineLength is the length after which a line without newline is emitted anyway
+const maxLineLength = 64 * 1024
+
+// ANSI colors given to directories in turn, and to final statuses
+var (
+	dirColors    = []string{"36", "33", "35", "32", "34", "96", "93", "95", "92", "94"}
+	colorFailure = "31"
+	colorSuccess = "32"
+	colorOther   = "33"
+)
+
+// ColorEnabled reports whether output written to f should be colored: f is a terminal
+// and NO_COLOR is not set
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// LineWriter splits the output written to it into lines and passes every complete line to emit,
+// so that lines of concurrent commands never tear. A nil LineWriter discards everything.
+type LineWriter struct {
+	emit func(line string)
+	buf  []byte
+}
+
+// NewLineWriter returns a LineWriter passing each line, without its line ending, to emit
+func NewLineWriter(emit func(line string)) *LineWriter {
+	return &LineWriter{emit: emit}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	if w == nil {
+		return len(p), nil
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLineLength {
+		w.Flush()
+	}
+	return len(p), nil
+}
+
+// teeLines returns a LineWriter passing every line to each of writers, nil when all are nil
+func teeLines(writers []*LineWriter) *LineWriter {
+	var targets []*LineWriter
+	for _, writer := range writers {
+		if writer != nil {
+			targets = append(targets, writer)
+		}
+	}
+	switch len(targets) {
+	case 0:
+		return nil
+	case 1:
+		return targets[0]
+	}
+	return NewLineWriter(func(line string) {
+		for _, target := range targets {
+			target.emit(line)
+		}
+	})
+}
+
+// Flush emits the last line when it has no line ending
+func (w *LineWriter) Flush() {
+	if w == nil || len(w.buf) == 0 {
+		return
+	}
+	w.emit(strings.TrimSuffix(string(w.buf), "\r"))
+	w.buf = w.buf[:0]
+}
+
+// Stream renders a run as it happens: every line printed by a command and every step and
+// final status, prefixed with its directory
+type Stream struct {
+	mu       sync.Mutex
+	out      io.Writer
+	color    bool
+	width    int               // Length of the longest directory, to align the output
+	colors   map[string]string // Color of each directory
+	lastStep map[string]int    // Last step announced for each directory
+	finished map[string]bool   // Directories whose final status was shown
+}
+
+// NewStream creates a Stream writing to out, coloring each of dirs when color is set
+func NewStream(out io.Writer, dirs []string, color bool) *Stream {
+	s := &Stream{
+		out:      out,
+		color:    color,
+		colors:   make(map[string]string),
+		lastStep: make(map[string]int),
+		finished: make(map[string]bool),
+	}
+	for i, dir := range dirs {
+		s.colors[dir] = dirColors[i%len(dirColors)]
+		s.width = max(s.width, len(dir))
+	}
+	return s
+}
+
+// colored wraps text in an ANSI color when colors are enabled
+func (s *Stream) colored(code, text string) string {
+	if !s.color {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// Println writes a single line for dir in one write
+func (s *Stream) Println(dir, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := s.colored(s.colors[dir], fmt.Sprintf("[%-*s]", s.width, dir))
+	fmt.Fprintf(s.out, "%s %s\n", prefix, line)
+}
+
+// StepOutput returns the writers streaming the stdout and stderr of a step of dir
+func (s *Stream) StepOutput(dir string, step int) (stdout, stderr *LineWriter) {
+	stdout = NewLineWriter(func(line string) { s.Println(dir, line) })
+	stderr = NewLineWriter(func(line string) { s.Println(dir, line) })
+	return stdout, stderr
+}
+
+// StepFinished does nothing: the output of the step was already shown
+func (s *Stream) StepFinished(dir string, result StepResult) {}
+
+// Update announces a new step or the final status of a directory
+func (s *Stream) Update(progress *Progress) {
+	s.mu.Lock()
+	announce := progress.Status == StatusProcessing && progress.Step > 0 && s.lastStep[progress.Dir] != progress.Step
+	finish := progress.Status != StatusProcessing && !s.finished[progress.Dir]
+	s.lastStep[progress.Dir] = progress.Step
+	s.finished[progress.Dir] = s.finished[progress.Dir] || finish
+	s.mu.Unlock()
+
+	switch {
+	case announce:
+		s.Println(progress.Dir, s.colored("1", fmt.Sprintf("step %d/%d: %s", progress.Step, progress.Total, progress.Command)))
+	case finish:
+		code := colorOther
+		if strings.HasPrefix(progress.Status, StatusSuccess) {
+			code = colorSuccess
+		} else if IsFailure(progress.Status) {
+			code = colorFailure
+		}
+		line := s.colored(code, progress.Status)
+		if !strings.HasPrefix(progress.Status, StatusSuccess) {
+			line += " | " + progress.Command
+		}
+		if summary := progress.StepSummary(); summary != "" {
+			line += " | " + summary
+		}
+		s.Println(progress.Dir, line)
+	}
+}
@@ -0,0 +1,117 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uilive"
+)
+
+// viewInterval is how often the View redraws when directories changed
+const viewInterval = 100 * time.Millisecond
+
+// View renders the status of every directory in place in the terminal, one line each
+type View struct {
+	mu      sync.Mutex
+	writer  *uilive.Writer
+	order   []string
+	status  map[string]Progress // Last update of every directory
+	changed bool                // A directory changed since the last redraw
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewView creates a View of results, the progress of every directory in processing order
+func NewView(results []Progress) *View {
+	v := &View{
+		writer:  uilive.New(),
+		status:  make(map[string]Progress),
+		changed: true,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, result := range results {
+		v.order = append(v.order, result.Dir)
+		v.status[result.Dir] = result
+	}
+	return v
+}
+
+// Start draws the view and keeps redrawing it until Stop is called
+func (v *View) Start() {
+	v.writer.Start()
+	go func() {
+		defer close(v.stopped)
+		ticker := time.NewTicker(viewInterval)
+		defer ticker.Stop()
+		for {
+			v.draw(false)
+			select {
+			case <-v.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop draws the final state of the view
+func (v *View) Stop() {
+	close(v.done)
+	<-v.stopped
+	v.draw(true)
+	v.writer.Stop()
+}
+
+// draw writes every directory when one changed since the last redraw, or when forced
+func (v *View) draw(force bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.changed && !force {
+		return
+	}
+	v.changed = false
+	for _, dir := range v.order {
+		progress := v.status[dir]
+		writeStatus(v.writer, &progress)
+	}
+	v.writer.Flush()
+}
+
+// writeStatus writes the line of a directory, with the output of a failure or timeout
+func writeStatus(w io.Writer, progress *Progress) {
+	if progress.Status == StatusProcessing {
+		if progress.Total > 0 {
+			fmt.Fprintf(w, "%s | step: %d/%d | command: %s\n", progress.Dir, progress.Step, progress.Total, progress.Command)
+		} else {
+			fmt.Fprintf(w, "%s | %s\n", progress.Dir, progress.Command)
+		}
+	} else if IsFailure(progress.Status) {
+		fmt.Fprintf(w, "%s | ERROR: %s\n%s\n", progress.Dir, progress.Command, progress.Output)
+	} else if summary := progress.StepSummary(); summary != "" {
+		fmt.Fprintf(w, "%s | %s | %s\n", progress.Dir, progress.Status, summary)
+	} else {
+		fmt.Fprintf(w, "%s | %s\n", progress.Dir, progress.Status)
+	}
+}
+
+// Update records the new state of a directory for the next redraw
+func (v *View) Update(progress *Progress) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.status[progress.Dir]; !ok {
+		v.order = append(v.order, progress.Dir)
+	}
+	v.status[progress.Dir] = *progress
+	v.changed = true
+}
+
+// StepOutput ignores the output of steps: the view only shows statuses
+func (v *View) StepOutput(dir string, step int) (stdout, stderr *LineWriter) {
+	return nil, nil
+}
+
+// StepFinished does nothing: the view shows steps through Update
+func (v *View) StepFinished(dir string, result StepResult) {}
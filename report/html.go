@@ -0,0 +1,264 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// htmlReport is the data rendered by htmlTemplate
+type htmlReport struct {
+	Dir      string
+	Started  string
+	Finished string
+	Duration string
+	Counts   []htmlCount
+	Dirs     []htmlDir
+}
+
+type htmlCount struct {
+	Result string
+	Count  int
+}
+
+// htmlDir is a row of the directory table and a bar of the timeline
+type htmlDir struct {
+	Dir        string
+	Status     string
+	Result     string
+	Message    string
+	Seconds    float64
+	Duration   string
+	Attempts   int
+	FailedStep int
+	Steps      []htmlStep
+
+	InTimeline bool
+	Left       string // Position of the bar in the timeline, in percent
+	Width      string
+	Segments   []htmlSegment
+}
+
+type htmlStep struct {
+	Step     int
+	Command  string
+	Status   string
+	Result   string
+	Duration string
+	Attempts string
+	ExitCode int
+	Ran      bool
+	Stdout   string
+	Stderr   string
+}
+
+// htmlSegment is a step inside a timeline bar
+type htmlSegment struct {
+	Left   string
+	Width  string
+	Result string
+	Title  string
+}
+
+// WriteHTML writes a self-contained HTML report of a run: summary counts, a sortable table of
+// directories with the output of every step, and a timeline of when each directory ran
+func WriteHTML(path string, manifest *progress.Manifest, results []progress.Progress) error {
+	report := htmlReport{
+		Dir:      manifest.Dir,
+		Started:  manifest.Started.Format("02/01/2006 15:04:05"),
+		Finished: manifest.Finished.Format("02/01/2006 15:04:05"),
+		Duration: formatDuration(manifest.Finished.Sub(manifest.Started)),
+	}
+
+	counts := make(map[string]int)
+	for _, result := range manifest.Directories {
+		counts[result.Result]++
+	}
+	for _, result := range []string{progress.ResultSuccess, progress.ResultFailed, progress.ResultTimeout, progress.ResultCancelled, progress.ResultSkipped, progress.ResultUnprocessed} {
+		if counts[result] > 0 {
+			report.Counts = append(report.Counts, htmlCount{Result: result, Count: counts[result]})
+		}
+	}
+
+	span := manifest.Finished.Sub(manifest.Started)
+	for _, result := range results {
+		report.Dirs = append(report.Dirs, htmlDirectory(result, manifest.Started, span))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create HTML report: %w", err)
+	}
+	defer file.Close()
+	if err := htmlTemplate.Execute(file, report); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// htmlDirectory converts the progress of a directory into its row and timeline bar
+func htmlDirectory(result progress.Progress, runStart time.Time, span time.Duration) htmlDir {
+	dir := htmlDir{
+		Dir:        result.Dir,
+		Status:     result.Status,
+		Result:     progress.Result(result.Status),
+		Message:    result.Command,
+		Seconds:    result.Duration.Seconds(),
+		Duration:   formatDuration(result.Duration),
+		FailedStep: result.FailedStep,
+	}
+
+	for i, command := range result.Commands {
+		step := htmlStep{Step: i + 1, Command: command, Result: progress.ResultSkipped, Status: "Not run"}
+		if slices.Contains(result.SkippedSteps, i+1) {
+			step.Status = "Skipped after an earlier failure"
+		}
+		if ran := stepResult(result, i+1); ran != nil {
+			dir.Attempts += ran.Attempts
+			step = htmlStep{
+				Step:     ran.Step,
+				Command:  ran.Command,
+				Status:   ran.Status,
+				Result:   progress.Result(ran.Status),
+				Duration: formatDuration(ran.Duration),
+				Attempts: fmt.Sprintf("%d/%d", ran.Attempts, ran.MaxAttempts),
+				ExitCode: ran.ExitCode,
+				Ran:      true,
+				Stdout:   ran.Stdout,
+				Stderr:   ran.Stderr,
+			}
+		}
+		dir.Steps = append(dir.Steps, step)
+	}
+
+	// Directories that ran in this session are placed on the timeline, with a segment per step
+	if !result.Started.IsZero() && span > 0 {
+		dir.InTimeline = true
+		dir.Left = percent(result.Started.Sub(runStart), span)
+		dir.Width = percent(max(result.Duration, span/1000), span)
+		for _, step := range result.Steps {
+			if result.Duration <= 0 {
+				break
+			}
+			dir.Segments = append(dir.Segments, htmlSegment{
+				Left:   percent(step.Started.Sub(result.Started), result.Duration),
+				Width:  percent(step.Duration, result.Duration),
+				Result: progress.Result(step.Status),
+				Title:  fmt.Sprintf("%d: %s (%s, %s)", step.Step, step.Command, step.Status, formatDuration(step.Duration)),
+			})
+		}
+	}
+	return dir
+}
+
+// percent formats part as a percentage of whole for a CSS length
+func percent(part, whole time.Duration) string {
+	return fmt.Sprintf("%.3f%%", min(max(float64(part)/float64(whole)*100, 0), 100))
+}
+
+// formatDuration formats a duration like "3m 5s", or "1.25s" under a minute
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+	return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>mdir-run report: {{.Dir}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.15em; margin-top: 2em; }
+.meta { color: #666; }
+.counts { display: flex; gap: 1em; flex-wrap: wrap; }
+.count { padding: .6em 1em; border-radius: 6px; color: #fff; min-width: 6em; }
+.count b { display: block; font-size: 1.6em; }
+.success { background: #2e7d32; }
+.failed { background: #c62828; }
+.timeout { background: #ef6c00; }
+.cancelled, .unprocessed { background: #757575; }
+.skipped { background: #9e9e9e; }
+.total { background: #455a64; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+th { cursor: pointer; user-select: none; background: #f5f5f5; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+.status { color: #fff; padding: .1em .4em; border-radius: 4px; white-space: nowrap; }
+details { margin: .2em 0; }
+summary { cursor: pointer; }
+pre { background: #f7f7f7; padding: .6em; overflow: auto; max-height: 30em; white-space: pre-wrap; }
+.timeline { position: relative; border-left: 1px solid #ccc; }
+.lane { display: flex; align-items: center; height: 1.5em; }
+.lane .name { width: 14em; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; font-size: .85em; }
+.lane .track { position: relative; flex: 1; height: 1em; background: #fafafa; }
+.bar { position: absolute; top: 0; height: 100%; background: #ccc; }
+.segment { position: absolute; top: 0; height: 100%; border-right: 1px solid #fff; box-sizing: border-box; }
+</style>
+</head>
+<body>
+<h1>mdir-run report: {{.Dir}}</h1>
+<p class="meta">Started {{.Started}} &middot; finished {{.Finished}} &middot; total {{.Duration}}</p>
+
+<div class="counts">
+<div class="count total"><b>{{len .Dirs}}</b>directories</div>
+{{range .Counts}}<div class="count {{.Result}}"><b>{{.Count}}</b>{{.Result}}</div>
+{{end}}</div>
+
+<h2>Directories</h2>
+<table id="dirs">
+<thead><tr><th data-type="text">Directory</th><th data-type="text">Status</th><th data-type="number">Duration</th><th data-type="number">Attempts</th><th data-type="number">Failing step</th><th>Steps</th></tr></thead>
+<tbody>
+{{range .Dirs}}<tr>
+<td data-sort="{{.Dir}}">{{.Dir}}</td>
+<td data-sort="{{.Result}}"><span class="status {{.Result}}">{{.Status}}</span>{{if ne .Result "success"}}<div>{{.Message}}</div>{{end}}</td>
+<td data-sort="{{.Seconds}}">{{.Duration}}</td>
+<td data-sort="{{.Attempts}}">{{.Attempts}}</td>
+<td data-sort="{{.FailedStep}}">{{if .FailedStep}}{{.FailedStep}}{{end}}</td>
+<td>{{range .Steps}}<details>
+<summary><span class="status {{.Result}}">{{.Step}}</span> {{.Command}}{{if .Ran}} &middot; {{.Status}} &middot; {{.Duration}}{{else}} &middot; {{.Status}}{{end}}</summary>
+{{if .Ran}}<p>Attempts {{.Attempts}} &middot; exit code {{.ExitCode}}</p>
+{{if .Stdout}}<p>Stdout</p><pre>{{.Stdout}}</pre>{{end}}
+{{if .Stderr}}<p>Stderr</p><pre>{{.Stderr}}</pre>{{end}}
+{{if not (or .Stdout .Stderr)}}<p>No output</p>{{end}}{{end}}
+</details>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+
+<h2>Timeline</h2>
+<div class="timeline">
+{{range .Dirs}}{{if .InTimeline}}<div class="lane"><div class="name" title="{{.Dir}}">{{.Dir}}</div><div class="track">
+<div class="bar" style="left: {{.Left}}; width: {{.Width}}" title="{{.Dir}}: {{.Status}} ({{.Duration}})">
+{{range .Segments}}<div class="segment {{.Result}}" style="left: {{.Left}}; width: {{.Width}}" title="{{.Title}}"></div>{{end}}
+</div></div></div>
+{{end}}{{end}}</div>
+
+<script>
+document.querySelectorAll("#dirs th[data-type]").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#dirs tbody");
+    var ascending = !th.classList.contains("asc");
+    document.querySelectorAll("#dirs th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+    th.classList.add(ascending ? "asc" : "desc");
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[column].dataset.sort, y = b.cells[column].dataset.sort;
+      var order = th.dataset.type === "number" ? parseFloat(x) - parseFloat(y) : x.localeCompare(y);
+      return ascending ? order : -order;
+    });
+    rows.forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
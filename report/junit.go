@@ -0,0 +1,178 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the steps of a directory
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is a single step, or the directory itself when no step ran
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitOutcome `xml:"failure,omitempty"`
+	Error     *junitOutcome `xml:"error,omitempty"`
+	Skipped   *junitOutcome `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitOutcome struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results of a run as a JUnit XML report: every directory is a
+// testsuite and every step a testcase. Failed commands are failures, timeouts and
+// cancellations are errors. elapsed is the duration of the whole run.
+func WriteJUnit(path string, results []progress.Progress, elapsed time.Duration) error {
+	report := junitTestSuites{Name: "mdir-run", Time: seconds(elapsed)}
+	for _, result := range results {
+		suite := junitSuite(result)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+	if err := os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// junitSuite converts the progress of a directory into a testsuite
+func junitSuite(result progress.Progress) junitTestSuite {
+	suite := junitTestSuite{
+		Name:       result.Dir,
+		Time:       seconds(result.Duration),
+		Properties: []junitProperty{{Name: "status", Value: result.Status}},
+	}
+	if !result.Started.IsZero() {
+		suite.Timestamp = result.Started.Format("2006-01-02T15:04:05")
+	}
+
+	if len(result.Commands) == 0 {
+		suite.Cases = []junitTestCase{directoryCase(result)}
+	}
+	for i, command := range result.Commands {
+		step := i + 1
+		testCase := junitTestCase{Name: fmt.Sprintf("%d: %s", step, command), Classname: result.Dir, Time: seconds(0)}
+		if ran := stepResult(result, step); ran != nil {
+			testCase = stepCase(result.Dir, *ran)
+		} else if slices.Contains(result.SkippedSteps, step) {
+			testCase.Skipped = &junitOutcome{Message: "Skipped after an earlier failure"}
+		} else {
+			testCase.Skipped = &junitOutcome{Message: "Not run"}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	for _, testCase := range suite.Cases {
+		suite.Tests++
+		switch {
+		case testCase.Failure != nil:
+			suite.Failures++
+		case testCase.Error != nil:
+			suite.Errors++
+		case testCase.Skipped != nil:
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+// stepResult returns the last result recorded for a step, nil when it did not run
+func stepResult(result progress.Progress, step int) *progress.StepResult {
+	for i := len(result.Steps) - 1; i >= 0; i-- {
+		if result.Steps[i].Step == step {
+			return &result.Steps[i]
+		}
+	}
+	return nil
+}
+
+// stepCase converts a step that ran into a testcase
+func stepCase(dir string, step progress.StepResult) junitTestCase {
+	testCase := junitTestCase{
+		Name:      fmt.Sprintf("%d: %s", step.Step, step.Command),
+		Classname: dir,
+		Time:      seconds(step.Duration),
+		SystemOut: step.Stdout,
+		SystemErr: step.Stderr,
+	}
+	outcome := &junitOutcome{
+		Message: step.Error,
+		Type:    step.Status,
+		Text:    fmt.Sprintf("Attempts: %d/%d\nExit code: %d", step.Attempts, step.MaxAttempts, step.ExitCode),
+	}
+	switch progress.Result(step.Status) {
+	case progress.ResultFailed:
+		testCase.Failure = outcome
+	case progress.ResultTimeout, progress.ResultCancelled:
+		testCase.Error = outcome
+	}
+	return testCase
+}
+
+// directoryCase describes a directory where no step ran, or that finished in an earlier run
+func directoryCase(result progress.Progress) junitTestCase {
+	testCase := junitTestCase{Name: "directory", Classname: result.Dir, Time: seconds(result.Duration)}
+	outcome := &junitOutcome{Message: result.Command, Type: result.Status}
+	switch progress.Result(result.Status) {
+	case progress.ResultSuccess:
+	case progress.ResultFailed:
+		testCase.Failure = outcome
+	case progress.ResultTimeout:
+		testCase.Error = outcome
+	default:
+		testCase.Skipped = outcome
+	}
+	return testCase
+}
+
+// seconds formats a duration the way JUnit expects it
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
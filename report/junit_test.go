@@ -0,0 +1,86 @@
+package report
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+func TestJUnitEscaping(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // Text read back from the report
+	}{
+		{"markup", `<testcase name="x"> & </testsuite>`, `<testcase name="x"> & </testsuite>`},
+		{"quotes", `it's "quoted"`, `it's "quoted"`},
+		{"cdata end", "]]> after", "]]> after"},
+		{"unicode", "✓ passed — ok", "✓ passed — ok"},
+		{"newlines and tabs", "line 1\n\tline 2", "line 1\n\tline 2"},
+		{"ansi colors", "\x1b[31mred\x1b[0m", "�[31mred�[0m"},
+		{"control characters", "a\x00b\x08c", "a�b�c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := progress.Progress{
+				Dir:      "dir " + tt.text,
+				Status:   "FAIL(1/1)",
+				Commands: []string{"make " + tt.text},
+				Steps: []progress.StepResult{{
+					Step:        1,
+					Command:     "make " + tt.text,
+					Status:      "FAIL(1/1)",
+					Error:       tt.text,
+					ExitCode:    2,
+					Attempts:    1,
+					MaxAttempts: 1,
+					Stdout:      tt.text,
+					Stderr:      tt.text,
+				}},
+			}
+			path := filepath.Join(t.TempDir(), "report.xml")
+			if err := WriteJUnit(path, []progress.Progress{result}, time.Second); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var report junitTestSuites
+			if err := xml.Unmarshal(data, &report); err != nil {
+				t.Fatalf("report is not valid XML: %v\n%s", err, data)
+			}
+			if len(report.Suites) != 1 || len(report.Suites[0].Cases) != 1 {
+				t.Fatalf("got %d suites, want one with one testcase:\n%s", len(report.Suites), data)
+			}
+			suite := report.Suites[0]
+			testCase := suite.Cases[0]
+			if testCase.Failure == nil {
+				t.Fatalf("testcase has no failure:\n%s", data)
+			}
+			for field, got := range map[string]string{
+				"testsuite name":  suite.Name,
+				"testcase name":   testCase.Name,
+				"failure message": testCase.Failure.Message,
+				"system-out":      testCase.SystemOut,
+				"system-err":      testCase.SystemErr,
+			} {
+				want := tt.want
+				switch field {
+				case "testsuite name":
+					want = "dir " + tt.want
+				case "testcase name":
+					want = "1: make " + tt.want
+				}
+				if got != want {
+					t.Errorf("%s = %q, want %q", field, got, want)
+				}
+			}
+		})
+	}
+}
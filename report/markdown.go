@@ -0,0 +1,93 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+
+	"github.com/gustavodamazio/mdir-run/progress"
+)
+
+// markdownTailLines is how many lines of output are shown for each failure
+const markdownTailLines = 20
+
+// resultIcons mark the status of every directory in the markdown summary
+var resultIcons = map[string]string{
+	progress.ResultSuccess:     "✅",
+	progress.ResultFailed:      "❌",
+	progress.ResultTimeout:     "⏱️",
+	progress.ResultCancelled:   "⏹️",
+	progress.ResultSkipped:     "⏭️",
+	progress.ResultUnprocessed: "❔",
+}
+
+// WriteMarkdown writes a compact markdown summary of a run, to paste into pull requests or
+// chat: a table of directories followed by the tail of the output of every failure
+func WriteMarkdown(path string, manifest *progress.Manifest, results []progress.Progress) error {
+	var b strings.Builder
+
+	counts := make(map[string]int)
+	for _, result := range manifest.Directories {
+		counts[result.Result]++
+	}
+	var parts []string
+	for _, result := range []string{progress.ResultSuccess, progress.ResultFailed, progress.ResultTimeout, progress.ResultCancelled, progress.ResultSkipped, progress.ResultUnprocessed} {
+		if counts[result] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[result], result))
+		}
+	}
+	fmt.Fprintf(&b, "### mdir-run: %d directories (%s)\n\n", len(manifest.Directories), strings.Join(parts, ", "))
+	fmt.Fprintf(&b, "`%s` · total time %s\n\n", manifest.Dir, formatDuration(manifest.Finished.Sub(manifest.Started)))
+
+	b.WriteString("| Directory | Status | Duration |\n|---|---|---|\n")
+	for _, result := range results {
+		fmt.Fprintf(&b, "| %s | %s %s | %s |\n", markdownCell(result.Dir), resultIcons[progress.Result(result.Status)], markdownCell(result.Status), formatDuration(result.Duration))
+	}
+
+	for _, result := range results {
+		if !progress.IsFailure(result.Status) {
+			continue
+		}
+		summary := result.Command
+		output := result.Output
+		if step := stepResult(result, result.FailedStep); step != nil {
+			summary = fmt.Sprintf("%s (step %d)", result.Command, step.Step)
+			output = step.Stderr
+			if strings.TrimSpace(output) == "" {
+				output = step.Stdout
+			}
+		}
+		fmt.Fprintf(&b, "\n<details><summary>%s: %s</summary>\n\n", html.EscapeString(result.Dir), html.EscapeString(summary))
+		if tail := tailLines(output, markdownTailLines); tail != "" {
+			fence := "```"
+			for strings.Contains(tail, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "%s\n%s\n%s\n", fence, tail, fence)
+		} else {
+			b.WriteString("No output\n")
+		}
+		b.WriteString("\n</details>\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write markdown summary: %w", err)
+	}
+	return nil
+}
+
+// markdownCell escapes text for a markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// tailLines returns the last n lines of text, ignoring trailing blank space
+func tailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\r\n\t "), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}